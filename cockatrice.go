@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Cockatrice's card database, cards.xml (version 3). Sets are named after
+// Gatherer's set names since we don't have set codes, and every printing
+// gets its Gatherer image as its picture.
+
+type cockatriceDatabase struct {
+	XMLName xml.Name         `xml:"cockatrice_carddatabase"`
+	Version int              `xml:"version,attr"`
+	Sets    []cockatriceSet  `xml:"sets>set"`
+	Cards   []cockatriceCard `xml:"cards>card"`
+}
+
+type cockatriceSet struct {
+	Name     string `xml:"name"`
+	LongName string `xml:"longname"`
+}
+
+type cockatriceCard struct {
+	Name      string               `xml:"name"`
+	Printings []cockatricePrinting `xml:"set"`
+	Related   []string             `xml:"related"`
+	Colors    []string             `xml:"color"`
+	ManaCost  string               `xml:"manacost"`
+	CMC       float64              `xml:"cmc"`
+	Type      string               `xml:"type"`
+	PT        string               `xml:"pt,omitempty"`
+	Loyalty   int                  `xml:"loyalty,omitempty"`
+	TableRow  int                  `xml:"tablerow"`
+	Text      string               `xml:"text"`
+	// "1" if the card enters the battlefield tapped
+	CIPT string `xml:"cipt,omitempty"`
+}
+
+type cockatricePrinting struct {
+	Set    string `xml:",chardata"`
+	MuId   int    `xml:"muId,attr,omitempty"`
+	Rarity string `xml:"rarity,attr,omitempty"`
+	Number string `xml:"num,attr,omitempty"`
+	PicURL string `xml:"picURL,attr,omitempty"`
+}
+
+// The rows of Cockatrice's battlefield, from the back
+const (
+	landRow = iota
+	permanentRow
+	creatureRow
+	spellRow
+)
+
+// Which row of the battlefield the card goes in
+func tableRow(card Card) int {
+	switch {
+	case contains(card.Types, "land"):
+		return landRow
+	case contains(card.Types, "instant") || contains(card.Types, "sorcery"):
+		return spellRow
+	case contains(card.Types, "creature"):
+		return creatureRow
+	}
+	return permanentRow
+}
+
+func toCockatrice(box *Deckbox, card Card) cockatriceCard {
+	c := cockatriceCard{
+		Name:     card.Name,
+		Related:  []string{},
+		Colors:   colorCodes(cardColors(card)),
+		ManaCost: strings.NewReplacer("{", "", "}", "").Replace(card.ManaCost),
+		CMC:      card.ConvertedCost,
+		Type:     card.TypeLine(),
+		Loyalty:  card.Loyalty,
+		TableRow: tableRow(card),
+		Text:     strings.Join(card.RulesText, "\n"),
+	}
+
+	if card.Power != "" || card.Toughness != "" {
+		c.PT = card.Power + "/" + card.Toughness
+	}
+
+	if partner, found := box.ById(card.PartnerCard); card.PartnerCard != "" && found {
+		c.Related = append(c.Related, partner.Name)
+	}
+
+	for _, p := range card.RulesText {
+		if strings.Contains(p, card.Name+" enters the battlefield tapped") {
+			c.CIPT = "1"
+		}
+	}
+
+	for _, e := range card.Editions {
+		if e.Set == "" {
+			continue
+		}
+
+		c.Printings = append(c.Printings, cockatricePrinting{
+			Set:    e.Set,
+			MuId:   e.MultiverseId,
+			Rarity: e.Rarity,
+			Number: e.Number,
+			PicURL: e.ImageURL(),
+		})
+	}
+
+	return c
+}
+
+// Cockatrice has one card for both halves of a split card, named and laid
+// out the way it's printed, e.g. "Stand // Deliver"
+func toCockatriceSplit(box *Deckbox, left, right Card) cockatriceCard {
+	c := toCockatrice(box, left)
+	r := toCockatrice(box, right)
+
+	colors := cardColors(left)
+
+	for color := range cardColors(right) {
+		colors[color] = true
+	}
+
+	c.Name = left.Name + " // " + right.Name
+	c.Related = []string{}
+	c.Colors = colorCodes(colors)
+	c.ManaCost += " // " + r.ManaCost
+	c.CMC += r.CMC
+	c.Type += " // " + r.Type
+	c.Text += "\n\n---\n\n" + r.Text
+	return c
+}
+
+// The whole box as a Cockatrice card database
+func CockatriceXML(box *Deckbox) ([]byte, error) {
+	db := cockatriceDatabase{Version: 3}
+	sets := []string{}
+
+	for _, card := range box.Cards {
+		for _, e := range card.Editions {
+			if e.Set != "" && !contains(sets, e.Set) {
+				sets = append(sets, e.Set)
+			}
+		}
+
+		partner, found := box.ById(card.PartnerCard)
+
+		if card.Special != "split" || card.PartnerCard == "" || !found {
+			db.Cards = append(db.Cards, toCockatrice(box, card))
+			continue
+		}
+
+		// The right half is written with the left
+		if names := faceNames(card, partner); names[0] == card.Name {
+			db.Cards = append(db.Cards, toCockatriceSplit(box, card, partner))
+		}
+	}
+
+	sort.Strings(sets)
+
+	for _, set := range sets {
+		db.Sets = append(db.Sets, cockatriceSet{Name: set, LongName: set})
+	}
+
+	blob, err := xml.MarshalIndent(db, "", "  ")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(fmt.Sprintf("%s%s\n", xml.Header, blob)), nil
+}
+
+func exportCockatrice(box *Deckbox, opts ExportOptions) error {
+	blob, err := CockatriceXML(box)
+
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(opts.Output, blob, FlushOptions{}, nil)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTableRow(t *testing.T) {
+	tests := map[int][]string{
+		landRow:      {"land"},
+		spellRow:     {"tribal", "instant"},
+		creatureRow:  {"artifact", "creature"},
+		permanentRow: {"legendary", "planeswalker"},
+	}
+
+	for row, types := range tests {
+		if r := tableRow(Card{Types: types}); r != row {
+			t.Errorf("%v should go in row %d, not %d", types, row, r)
+		}
+	}
+
+	if r := tableRow(Card{Types: []string{"land", "creature"}}); r != landRow {
+		t.Errorf("Land creatures go with the lands, not in row %d", r)
+	}
+}
+
+func TestCockatriceXML(t *testing.T) {
+	box := mtgjsonBox()
+	box.Cards = append(box.Cards, Card{Name: "Coastal Tower", Id: OracleId("Coastal Tower"), Types: []string{"land"},
+		RulesText: []string{"Coastal Tower enters the battlefield tapped.", "{T}: Add {W} or {U} to your mana pool."}})
+
+	blob, err := CockatriceXML(box)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(string(blob), `<?xml version="1.0" encoding="UTF-8"?>`+"\n<cockatrice_carddatabase version=\"3\">") {
+		t.Errorf("Missing the XML header: %s", blob[:100])
+	}
+
+	var db cockatriceDatabase
+	err = xml.Unmarshal(blob, &db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sets := []string{}
+
+	for _, set := range db.Sets {
+		sets = append(sets, set.Name)
+	}
+
+	if !reflect.DeepEqual(sets, []string{"Dark Ascension", "Invasion", "Modern Masters 2015", "New Phyrexia"}) {
+		t.Errorf("Sets are wrong: %v", sets)
+	}
+
+	cards := map[string]cockatriceCard{}
+
+	for _, card := range db.Cards {
+		cards[card.Name] = card
+	}
+
+	huntmaster := cards["Huntmaster of the Fells"]
+	expected := cockatriceCard{
+		Name: "Huntmaster of the Fells",
+		Printings: []cockatricePrinting{cockatricePrinting{Set: "Dark Ascension", MuId: 262875, Rarity: "mythic", Number: "140a",
+			PicURL: "http://gatherer.wizards.com/Handlers/Image.ashx?multiverseid=262875&type=card"}},
+		Related:  []string{"Ravager of the Fells"},
+		Colors:   []string{"R", "G"},
+		ManaCost: "2RG",
+		CMC:      4,
+		Type:     "Creature — Human Werewolf",
+		PT:       "2/2",
+		TableRow: creatureRow,
+		Text:     "At the beginning of each upkeep, if no spells were cast last turn, transform Huntmaster of the Fells.",
+	}
+
+	if !reflect.DeepEqual(huntmaster, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, huntmaster)
+	}
+
+	if ravager := cards["Ravager of the Fells"]; !reflect.DeepEqual(ravager.Colors, []string{"R", "G"}) {
+		t.Errorf("The back face's colors come from its color indicator: %v", ravager.Colors)
+	}
+
+	if karn := cards["Karn Liberated"]; len(karn.Printings) != 2 || karn.Loyalty != 6 || karn.TableRow != permanentRow {
+		t.Errorf("Karn is wrong: %+v", karn)
+	}
+
+	if tower := cards["Coastal Tower"]; tower.CIPT != "1" || tower.TableRow != landRow || len(tower.Colors) != 0 {
+		t.Errorf("Coastal Tower is wrong: %+v", tower)
+	}
+}
+
+func TestCockatriceSplitCard(t *testing.T) {
+	fire := Card{Id: OracleId("Fire"), Name: "Fire", ManaCost: "{1}{R}", ConvertedCost: 2, Types: []string{"instant"}, Special: "split",
+		RulesText: []string{"Fire deals 2 damage divided as you choose among one or two target creatures and/or players."},
+		Editions:  []Edition{Edition{MultiverseId: 27165, Set: "Apocalypse", Rarity: "uncommon", Number: "128"}}}
+	ice := Card{Id: OracleId("Ice"), Name: "Ice", ManaCost: "{1}{U}", ConvertedCost: 2, Types: []string{"instant"}, Special: "split",
+		RulesText: []string{"Tap target permanent.", "Draw a card."},
+		Editions:  []Edition{Edition{MultiverseId: 27165, Set: "Apocalypse", Rarity: "uncommon", Number: "128"}}}
+	fire.PartnerCard, ice.PartnerCard = ice.Id, fire.Id
+
+	blob, err := CockatriceXML(&Deckbox{Cards: []Card{fire, ice}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var db cockatriceDatabase
+	err = xml.Unmarshal(blob, &db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(db.Cards) != 1 {
+		t.Fatalf("Both halves should be one card, got %d", len(db.Cards))
+	}
+
+	expected := cockatriceCard{
+		Name: "Fire // Ice",
+		Printings: []cockatricePrinting{cockatricePrinting{Set: "Apocalypse", MuId: 27165, Rarity: "uncommon", Number: "128",
+			PicURL: "http://gatherer.wizards.com/Handlers/Image.ashx?multiverseid=27165&type=card"}},
+		Colors:   []string{"U", "R"},
+		ManaCost: "1R // 1U",
+		CMC:      4,
+		Type:     "Instant // Instant",
+		TableRow: spellRow,
+		Text: "Fire deals 2 damage divided as you choose among one or two target creatures and/or players." +
+			"\n\n---\n\nTap target permanent.\nDraw a card.",
+	}
+
+	if !reflect.DeepEqual(db.Cards[0], expected) {
+		t.Errorf("Expected %+v, got %+v", expected, db.Cards[0])
+	}
+}
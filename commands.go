@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Tools that work on a database that has already been crawled. Running
+// frantic with anything else crawls Gatherer.
+var commands = map[string]func(args []string) error{
+	"deck":     deckCommand,
+	"diff":     diffCommand,
+	"export":   exportCommand,
+	"merge":    mergeCommand,
+	"schema":   schemaCommand,
+	"search":   searchCommand,
+	"serve":    serveCommand,
+	"show":     showCommand,
+	"validate": validateCommand,
+}
+
+func usage() {
+	names := []string{}
+
+	for name := range commands {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "usage: %s [flags] cards.json\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s [%s] ...\n", os.Args[0], strings.Join(names, "|"))
+}
+
+// Load a database from any store, upgraded to the current schema
+func openDeckbox(path string) (Deckbox, error) {
+	if _, err := os.Stat(path); err != nil {
+		return Deckbox{}, err
+	}
+
+	store, err := openStore(path)
+
+	if err != nil {
+		return Deckbox{}, err
+	}
+
+	defer store.Close()
+
+	return store.Load()
+}
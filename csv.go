@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Cards as CSV or TSV for spreadsheets, with a row per card or a row per
+// printing. Fields with several values, like types or rules text, are
+// joined into one cell.
+
+type csvColumn struct {
+	name string
+	// Exactly one of these is set, depending on where the field lives
+	card    func(c Card) []string
+	edition func(e Edition) []string
+}
+
+func single(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
+
+var csvColumns = []csvColumn{
+	{name: "name", card: func(c Card) []string { return single(c.Name) }},
+	{name: "id", card: func(c Card) []string { return single(c.Id) }},
+	{name: "types", card: func(c Card) []string { return c.Types }},
+	{name: "subtypes", card: func(c Card) []string { return c.Subtypes }},
+	{name: "converted_cost", card: func(c Card) []string {
+		return single(strconv.FormatFloat(c.ConvertedCost, 'f', -1, 64))
+	}},
+	{name: "mana_cost", card: func(c Card) []string { return single(c.ManaCost) }},
+	{name: "special", card: func(c Card) []string { return single(c.Special) }},
+	{name: "partner_card", card: func(c Card) []string { return single(c.PartnerCard) }},
+	{name: "side", card: func(c Card) []string { return single(c.Side) }},
+	{name: "rules_text", card: func(c Card) []string { return c.RulesText }},
+	{name: "color_indicator", card: func(c Card) []string { return c.ColorIndicator }},
+	{name: "power", card: func(c Card) []string { return single(c.Power) }},
+	{name: "toughness", card: func(c Card) []string { return single(c.Toughness) }},
+	{name: "loyalty", card: func(c Card) []string {
+		if c.Loyalty == 0 {
+			return nil
+		}
+		return []string{strconv.Itoa(c.Loyalty)}
+	}},
+	{name: "set", edition: func(e Edition) []string { return single(e.Set) }},
+	{name: "watermark", edition: func(e Edition) []string { return single(e.Watermark) }},
+	{name: "rarity", edition: func(e Edition) []string { return single(e.Rarity) }},
+	{name: "artist", edition: func(e Edition) []string { return single(e.Artist) }},
+	{name: "multiverse_id", edition: func(e Edition) []string { return single(strconv.Itoa(e.MultiverseId)) }},
+	{name: "flavor_text", edition: func(e Edition) []string { return e.FlavorText }},
+	{name: "number", edition: func(e Edition) []string { return single(e.Number) }},
+}
+
+func columnNames(columns []csvColumn) []string {
+	names := []string{}
+
+	for _, c := range columns {
+		names = append(names, c.name)
+	}
+
+	return names
+}
+
+// Look up columns by name. No names means every column.
+func findColumns(names []string) ([]csvColumn, error) {
+	if len(names) == 0 {
+		return csvColumns, nil
+	}
+
+	columns := []csvColumn{}
+
+	for _, name := range names {
+		found := false
+
+		for _, c := range csvColumns {
+			if c.name == name {
+				columns = append(columns, c)
+				found = true
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("unknown column %s, expected one of %s", name, strings.Join(columnNames(csvColumns), ", "))
+		}
+	}
+
+	return columns, nil
+}
+
+// The header and rows for the box. Card rows list every distinct value a
+// printing column has across the card's printings. Printing rows have one
+// row per edition, and a row with empty printing columns for a card
+// without any.
+func CSVRows(box *Deckbox, opts ExportOptions) ([][]string, error) {
+	columns, err := findColumns(opts.Columns)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Rows != "card" && opts.Rows != "edition" {
+		return nil, fmt.Errorf("rows should be card or edition, not %s", opts.Rows)
+	}
+
+	rows := [][]string{columnNames(columns)}
+
+	cell := func(values []string) string {
+		return strings.Join(values, opts.Separator)
+	}
+
+	row := func(card Card, editions []Edition) []string {
+		cells := []string{}
+
+		for _, c := range columns {
+			if c.card != nil {
+				cells = append(cells, cell(c.card(card)))
+				continue
+			}
+
+			values := []string{}
+
+			for _, e := range editions {
+				for _, v := range c.edition(e) {
+					if !contains(values, v) {
+						values = append(values, v)
+					}
+				}
+			}
+
+			cells = append(cells, cell(values))
+		}
+
+		return cells
+	}
+
+	for _, card := range box.Cards {
+		if opts.Rows == "card" || len(card.Editions) == 0 {
+			rows = append(rows, row(card, card.Editions))
+			continue
+		}
+
+		for _, e := range card.Editions {
+			rows = append(rows, row(card, []Edition{e}))
+		}
+	}
+
+	return rows, nil
+}
+
+func exportDelimited(box *Deckbox, opts ExportOptions, comma rune) error {
+	rows, err := CSVRows(box, opts)
+
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+
+	// Excel only reads a CSV file as UTF-8, em dashes and all, when it
+	// starts with a byte order mark
+	if opts.BOM {
+		b.WriteString("\ufeff")
+	}
+
+	w := csv.NewWriter(&b)
+	w.Comma = comma
+	w.WriteAll(rows)
+
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	if opts.Output == "-" {
+		_, err = os.Stdout.Write(b.Bytes())
+		return err
+	}
+
+	return writeFileAtomic(opts.Output, b.Bytes(), FlushOptions{}, nil)
+}
+
+func exportCSV(box *Deckbox, opts ExportOptions) error {
+	return exportDelimited(box, opts, ',')
+}
+
+func exportTSV(box *Deckbox, opts ExportOptions) error {
+	return exportDelimited(box, opts, '\t')
+}
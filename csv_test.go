@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func csvBox() *Deckbox {
+	box := mtgjsonBox()
+	box.Cards = []Card{box.Cards[5], box.Cards[4]}
+	box.Cards[0].Editions = append(box.Cards[0].Editions, Edition{MultiverseId: 11, Set: "Invasion", Number: "11",
+		FlavorText: []string{"“Flying,” he said — “again.”"}})
+	return box
+}
+
+func TestCSVRowsPerCard(t *testing.T) {
+	rows, err := CSVRows(csvBox(), ExportOptions{Columns: []string{"name", "types", "set", "multiverse_id", "loyalty"}, Rows: "card", Separator: "|"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]string{
+		{"name", "types", "set", "multiverse_id", "loyalty"},
+		{"Birds of Paradise", "creature", "Invasion", "10|11", ""},
+		{"Karn Liberated", "legendary|planeswalker", "New Phyrexia|Modern Masters 2015", "220|221|222", "6"},
+	}
+
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected %q, got %q", expected, rows)
+	}
+}
+
+func TestCSVRowsPerEdition(t *testing.T) {
+	rows, err := CSVRows(csvBox(), ExportOptions{Columns: []string{"name", "multiverse_id", "flavor_text"}, Rows: "edition", Separator: " / "})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]string{
+		{"name", "multiverse_id", "flavor_text"},
+		{"Birds of Paradise", "10", "“Their wings,” / she said."},
+		{"Birds of Paradise", "11", "“Flying,” he said — “again.”"},
+		{"Karn Liberated", "220", ""},
+		{"Karn Liberated", "221", ""},
+		{"Karn Liberated", "222", ""},
+	}
+
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected %q, got %q", expected, rows)
+	}
+
+	if rows, _ := CSVRows(csvBox(), ExportOptions{Rows: "card"}); len(rows[0]) != len(csvColumns) {
+		t.Errorf("Every column should be written by default: %v", rows[0])
+	}
+
+	if _, err := CSVRows(csvBox(), ExportOptions{Columns: []string{"colour"}, Rows: "card"}); err == nil {
+		t.Errorf("Unknown columns should be an error")
+	}
+
+	if _, err := CSVRows(csvBox(), ExportOptions{Rows: "printing"}); err == nil {
+		t.Errorf("Unknown row kinds should be an error")
+	}
+}
+
+func TestExportCSVQuoting(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frantic")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	box := csvBox()
+	box.Cards[0].Editions[0].FlavorText = []string{`"Sing," she said, "sing of the trees."`, "—Elvish proverb"}
+
+	for _, comma := range []rune{',', '\t'} {
+		path := filepath.Join(dir, "cards.csv")
+		opts := ExportOptions{Output: path, Columns: []string{"name", "flavor_text"}, Rows: "edition", Separator: "\n", BOM: true}
+		err = exportDelimited(box, opts, comma)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		blob, err := ioutil.ReadFile(path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.HasPrefix(string(blob), "\ufeffname") {
+			t.Errorf("Expected a byte order mark: %q", blob[:10])
+		}
+
+		if !strings.Contains(string(blob), `"""Sing,"" she said, ""sing of the trees.""`+"\n—Elvish proverb\"") {
+			t.Errorf("Flavor text isn't quoted: %s", blob)
+		}
+
+		r := csv.NewReader(strings.NewReader(strings.TrimPrefix(string(blob), "\ufeff")))
+		r.Comma = comma
+		rows, err := r.ReadAll()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rows[1][1] != box.Cards[0].Editions[0].FlavorText[0]+"\n"+box.Cards[0].Editions[0].FlavorText[1] {
+			t.Errorf("Flavor text didn't survive a round trip: %q", rows[1][1])
+		}
+	}
+}
@@ -0,0 +1,502 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Deck lists in the formats people trade them in:
+//
+//	4 Lightning Bolt             plain text, "4x" works too
+//	SB: 2 [M10] Duress           Apprentice and MWS .dec
+//	4 Lightning Bolt (M10) 146   MTG Arena
+//	<Cards Quantity="4" ... />   MTGO .dek
+//
+// A "Sideboard" line or an SB: prefix marks the sideboard, and the cards
+// under a "Commander" line are the commander. In a list without any of
+// these, cards after the first blank line are the sideboard.
+
+type DeckEntry struct {
+	Count int    `json:"count"`
+	Name  string `json:"name"`
+	// The line the entry is on, or 0 in a .dek file
+	Line      int  `json:"line,omitempty"`
+	Sideboard bool `json:"sideboard,omitempty"`
+	// The deck's commander, which is in the main deck too
+	Commander bool `json:"commander,omitempty"`
+	// Filled in by Resolve. Both halves of a split card, or both faces of
+	// a double-faced card, with the named one first.
+	Cards []Card `json:"cards,omitempty"`
+	// The name Resolve matched, and how many edits away from Name it is.
+	// A prefix or a typo matches a card with a different name.
+	Matched  string `json:"matched,omitempty"`
+	Distance int    `json:"distance,omitempty"`
+}
+
+// Whether Resolve matched the name as written, ignoring case and accents
+func (e DeckEntry) Exact() bool {
+	return e.Matched == "" || nameKey(e.Matched) == nameKey(e.Name)
+}
+
+type Deck struct {
+	Main      []DeckEntry `json:"main"`
+	Sideboard []DeckEntry `json:"sideboard"`
+}
+
+var (
+	deckLinePattern = regexp.MustCompile(`^(?i:(sb:)\s*)?(?:(\d+)\s*(?:[xX]\s+|\s+))?(.+)$`)
+	// MWS puts the set before the name, Arena puts it and the collector
+	// number after
+	mwsSetPattern   = regexp.MustCompile(`^\[[^\]]*\]\s*`)
+	arenaSetPattern = regexp.MustCompile(`\s+\([A-Za-z0-9]+\)\s+\S+$`)
+)
+
+var sideboardHeaders = []string{"sideboard", "sideboard:", "sb:"}
+var mainHeaders = []string{"deck", "deck:", "main", "main:", "maindeck", "maindeck:", "main deck", "main deck:"}
+var commanderHeaders = []string{"commander", "commander:"}
+
+func (d *Deck) add(entry DeckEntry) {
+	if entry.Sideboard {
+		d.Sideboard = append(d.Sideboard, entry)
+	} else {
+		d.Main = append(d.Main, entry)
+	}
+}
+
+// Read a deck list in any of the supported formats
+func ParseDeck(r io.Reader) (*Deck, error) {
+	blob, err := ioutil.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	blob = bytes.TrimPrefix(blob, []byte("\ufeff"))
+
+	if bytes.HasPrefix(bytes.TrimSpace(blob), []byte("<")) {
+		return parseDek(blob)
+	}
+
+	return parseDeckText(blob)
+}
+
+type dekFile struct {
+	Cards []struct {
+		Quantity  int    `xml:"Quantity,attr"`
+		Sideboard bool   `xml:"Sideboard,attr"`
+		Name      string `xml:"Name,attr"`
+	} `xml:"Cards"`
+}
+
+// An MTGO .dek file
+func parseDek(blob []byte) (*Deck, error) {
+	var dek dekFile
+	err := xml.Unmarshal(blob, &dek)
+
+	if err != nil {
+		return nil, err
+	}
+
+	deck := &Deck{}
+
+	for _, c := range dek.Cards {
+		if c.Quantity < 1 {
+			return nil, fmt.Errorf("%s: quantity should be positive, not %d", c.Name, c.Quantity)
+		}
+
+		deck.add(DeckEntry{Count: c.Quantity, Name: c.Name, Sideboard: c.Sideboard})
+	}
+
+	return deck, nil
+}
+
+type deckLine struct {
+	number int
+	text   string
+}
+
+func parseDeckText(blob []byte) (*Deck, error) {
+	lines := []deckLine{}
+	marked := false
+	scanner := bufio.NewScanner(bytes.NewReader(blob))
+
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(text, "//") || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		lower := strings.ToLower(text)
+
+		if contains(sideboardHeaders, lower) || contains(commanderHeaders, lower) || strings.HasPrefix(lower, "sb:") {
+			marked = true
+		}
+
+		lines = append(lines, deckLine{n, text})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	deck := &Deck{}
+	sideboard, commander := false, false
+
+	for _, line := range lines {
+		lower := strings.ToLower(line.text)
+
+		switch {
+		case line.text == "":
+			if !marked && len(deck.Main) > 0 {
+				sideboard = true
+			}
+			commander = false
+			continue
+		case contains(sideboardHeaders, lower):
+			sideboard, commander = true, false
+			continue
+		case contains(commanderHeaders, lower):
+			sideboard, commander = false, true
+			continue
+		case contains(mainHeaders, lower):
+			sideboard, commander = false, false
+			continue
+		}
+
+		entry, err := parseDeckLine(line.text)
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line.number, err)
+		}
+
+		entry.Line = line.number
+		entry.Sideboard = entry.Sideboard || sideboard
+		entry.Commander = commander && !entry.Sideboard
+		deck.add(entry)
+	}
+
+	return deck, nil
+}
+
+func parseDeckLine(text string) (DeckEntry, error) {
+	m := deckLinePattern.FindStringSubmatch(text)
+	entry := DeckEntry{Count: 1, Sideboard: m[1] != ""}
+
+	if m[2] != "" {
+		entry.Count, _ = strconv.Atoi(m[2])
+	}
+
+	if entry.Count < 1 {
+		return entry, fmt.Errorf("count should be positive in %q", text)
+	}
+
+	name := mwsSetPattern.ReplaceAllString(m[3], "")
+	entry.Name = strings.TrimSpace(arenaSetPattern.ReplaceAllString(name, ""))
+
+	if entry.Name == "" {
+		return entry, fmt.Errorf("no card name in %q", text)
+	}
+
+	return entry, nil
+}
+
+// A deck entry that doesn't name a card in the database
+type UnknownCard struct {
+	Line        int      `json:"line,omitempty"`
+	Name        string   `json:"name"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+func (u UnknownCard) String() string {
+	s := u.Name
+
+	if u.Line > 0 {
+		s = fmt.Sprintf("line %d: %s", u.Line, s)
+	}
+
+	if len(u.Suggestions) > 0 {
+		s += ", did you mean " + strings.Join(u.Suggestions, ", ") + "?"
+	}
+
+	return s
+}
+
+// Find the cards every entry names, the way show does, and return the
+// entries that don't name any
+func (d *Deck) Resolve(names *NameIndex) []UnknownCard {
+	unknown := []UnknownCard{}
+
+	for _, entries := range [][]DeckEntry{d.Main, d.Sideboard} {
+		for i := range entries {
+			match, err := names.Find(entries[i].Name)
+
+			if err != nil {
+				u := UnknownCard{Line: entries[i].Line, Name: entries[i].Name}
+
+				if notFound, ok := err.(NameNotFound); ok {
+					u.Suggestions = matchNames(notFound.Suggestions)
+				}
+
+				unknown = append(unknown, u)
+				continue
+			}
+
+			entries[i].Cards = match.Cards
+			entries[i].Matched = match.Name
+			entries[i].Distance = match.Distance
+		}
+	}
+
+	return unknown
+}
+
+// The resolved entries that didn't name their card exactly, so a typo like
+// "Lightning Blot" doesn't go unnoticed
+func (d *Deck) Inexact() []DeckEntry {
+	inexact := []DeckEntry{}
+
+	for _, entries := range [][]DeckEntry{d.Main, d.Sideboard} {
+		for _, e := range entries {
+			if !e.Exact() {
+				inexact = append(inexact, e)
+			}
+		}
+	}
+
+	return inexact
+}
+
+type DeckStats struct {
+	// Cards in the main deck and sideboard
+	Cards     int `json:"cards"`
+	Sideboard int `json:"sideboard"`
+	// Nonland cards in the main deck by converted mana cost, rounded down
+	Curve       map[int]int `json:"curve"`
+	AverageCost float64     `json:"average_cost"`
+	// Colored mana symbols in the main deck's mana costs. A hybrid symbol
+	// counts for each of its colors.
+	Colors map[string]int `json:"colors"`
+	// Cards in the main deck of each type. An artifact creature counts as
+	// both.
+	Types map[string]int `json:"types"`
+}
+
+// Work out the stats for the resolved main deck. Unknown cards are left
+// out, and split cards count with both halves' costs.
+func (d *Deck) Stats() DeckStats {
+	stats := DeckStats{Curve: map[int]int{}, Colors: map[string]int{}, Types: map[string]int{}}
+	nonland := 0
+	totalCost := 0.0
+
+	for _, e := range d.Sideboard {
+		stats.Sideboard += e.Count
+	}
+
+	for _, e := range d.Main {
+		stats.Cards += e.Count
+
+		if len(e.Cards) == 0 {
+			continue
+		}
+
+		card := e.Cards[0]
+		faces := []Card{card}
+
+		if card.Special == "split" {
+			faces = e.Cards
+		}
+
+		for _, t := range card.Types {
+			if !contains(supertypes, t) {
+				stats.Types[t] += e.Count
+			}
+		}
+
+		cost := 0.0
+
+		for _, face := range faces {
+			cost += face.ConvertedCost
+			parsed, _ := symbols.Parse(face.ManaCost)
+
+			for _, s := range parsed {
+				for _, color := range s.Colors {
+					stats.Colors[color] += e.Count
+				}
+			}
+		}
+
+		if !contains(card.Types, "land") {
+			stats.Curve[int(cost)] += e.Count
+			nonland += e.Count
+			totalCost += cost * float64(e.Count)
+		}
+	}
+
+	if nonland > 0 {
+		stats.AverageCost = totalCost / float64(nonland)
+	}
+
+	return stats
+}
+
+func sortedKeys(counts map[string]int) []string {
+	keys := []string{}
+
+	for key := range counts {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func writeDeckStats(w io.Writer, stats DeckStats) {
+	fmt.Fprintf(w, "%d cards, %d in the sideboard\n", stats.Cards, stats.Sideboard)
+	fmt.Fprintf(w, "Average cost %.2f\n", stats.AverageCost)
+
+	costs := []int{}
+
+	for cost := range stats.Curve {
+		costs = append(costs, cost)
+	}
+
+	sort.Ints(costs)
+	fmt.Fprintln(w, "\nCurve")
+
+	for _, cost := range costs {
+		fmt.Fprintf(w, "%4d %3d %s\n", cost, stats.Curve[cost], strings.Repeat("#", stats.Curve[cost]))
+	}
+
+	fmt.Fprintln(w, "\nColors")
+
+	for _, color := range sortedKeys(stats.Colors) {
+		fmt.Fprintf(w, "%8s %3d\n", color, stats.Colors[color])
+	}
+
+	fmt.Fprintln(w, "\nTypes")
+
+	for _, t := range sortedKeys(stats.Types) {
+		fmt.Fprintf(w, "%14s %3d\n", t, stats.Types[t])
+	}
+}
+
+func openDeck(path string) (*Deck, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return ParseDeck(f)
+}
+
+// frantic deck [-db cards.json] [-json] [-format modern] [-formats formats.json] deck.txt
+func deckCommand(args []string) error {
+	flags := flag.NewFlagSet("deck", flag.ExitOnError)
+	dbPath := flags.String("db", "cards.json", "The database to look cards up in")
+	asJSON := flags.Bool("json", false, "Print the stats, unknown and inexactly matched cards and violations as JSON")
+	formatName := flags.String("format", "", "Check the deck is legal in this format")
+	formatsPath := flags.String("formats", "formats.json", "The format definitions to check against")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: deck [-db cards.json] [-json] [-format modern] [-formats formats.json] deck.txt")
+	}
+
+	var format *Format
+
+	if *formatName != "" {
+		formats, err := LoadFormats(*formatsPath)
+
+		if err != nil {
+			return err
+		}
+
+		f, found := formats.Format(*formatName)
+
+		if !found {
+			return fmt.Errorf("unknown format %s, expected one of %s", *formatName, strings.Join(formats.Names(), ", "))
+		}
+
+		format = &f
+	}
+
+	deck, err := openDeck(flags.Arg(0))
+
+	if err != nil {
+		return err
+	}
+
+	box, err := openDeckbox(*dbPath)
+
+	if err != nil {
+		return err
+	}
+
+	unknown := deck.Resolve(NewNameIndex(&box))
+	inexact := deck.Inexact()
+	stats := deck.Stats()
+	violations := []Violation{}
+
+	if format != nil {
+		violations = format.Check(deck)
+	}
+
+	if *asJSON {
+		report := map[string]interface{}{"stats": stats, "unknown": unknown, "inexact": inexact}
+
+		if format != nil {
+			report["violations"] = violations
+		}
+
+		blob, err := json.MarshalIndent(report, "", "  ")
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(blob))
+	} else {
+		for _, u := range unknown {
+			fmt.Fprintf(os.Stderr, "Unknown card %s\n", u)
+		}
+
+		for _, e := range inexact {
+			if e.Line > 0 {
+				fmt.Fprintf(os.Stderr, "line %d: ", e.Line)
+			}
+			fmt.Fprintf(os.Stderr, "%s matched %s\n", e.Name, e.Matched)
+		}
+
+		writeDeckStats(os.Stdout, stats)
+
+		if format != nil {
+			fmt.Printf("\n%s\n", format.Name)
+			writeViolations(os.Stdout, violations)
+		}
+	}
+
+	if len(unknown) > 0 {
+		return fmt.Errorf("%d unknown cards", len(unknown))
+	}
+
+	if len(violations) > 0 {
+		return fmt.Errorf("the deck isn't legal in %s", format.Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func deckBox() *Deckbox {
+	cards := []Card{
+		Card{Name: "Lightning Bolt", Types: []string{"instant"}, ManaCost: "{R}", ConvertedCost: 1},
+		Card{Name: "Goblin Guide", Types: []string{"creature"}, Subtypes: []string{"goblin", "scout"}, ManaCost: "{R}", ConvertedCost: 1},
+		Card{Name: "Boros Reckoner", Types: []string{"creature"}, ManaCost: "{R/W}{R/W}{R/W}", ConvertedCost: 3},
+		Card{Name: "Duress", Types: []string{"sorcery"}, ManaCost: "{B}", ConvertedCost: 1},
+		Card{Name: "Fire", Types: []string{"instant"}, ManaCost: "{1}{R}", ConvertedCost: 2, Special: "split"},
+		Card{Name: "Ice", Types: []string{"instant"}, ManaCost: "{1}{U}", ConvertedCost: 2, Special: "split"},
+		Card{Name: "Mountain", Types: []string{"basic", "land"}, Subtypes: []string{"mountain"}},
+		Card{Name: "Ornithopter", Types: []string{"artifact", "creature"}, ManaCost: "{0}"},
+	}
+
+	for i := range cards {
+		cards[i].Id = OracleId(cards[i].Name)
+	}
+
+	cards[4].PartnerCard, cards[5].PartnerCard = cards[5].Id, cards[4].Id
+
+	return &Deckbox{Cards: cards}
+}
+
+func deckEntries(entries []DeckEntry) []string {
+	lines := []string{}
+
+	for _, e := range entries {
+		lines = append(lines, strings.TrimSpace(strings.Repeat("*", e.Count)+" "+e.Name))
+	}
+
+	return lines
+}
+
+func TestParseDeckFormats(t *testing.T) {
+	tests := map[string]string{
+		"plain": `// Burn
+4 Lightning Bolt
+4x Goblin Guide
+Fire // Ice
+20 Mountain
+
+Sideboard
+3 Duress`,
+		"blank line": `4 Lightning Bolt
+4x Goblin Guide
+1 Fire/Ice
+20 Mountain
+
+3 Duress`,
+		"mws": `// NAME : Burn
+        4 [M10] Lightning Bolt
+        4 [ZEN] Goblin Guide
+        1 [AP] Fire // Ice
+        20 [M10] Mountain
+
+SB:     3 [M10] Duress`,
+		"arena": `Deck
+4 Lightning Bolt (M10) 146
+4 Goblin Guide (ZEN) 126
+1 Fire // Ice (MH2) 290
+20 Mountain (M10) 242
+
+Sideboard
+3 Duress (M10) 96`,
+		"dek": `<?xml version="1.0" encoding="utf-8"?>
+<Deck xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <NetDeckID>0</NetDeckID>
+  <PreconstructedDeckID>0</PreconstructedDeckID>
+  <Cards CatID="36024" Quantity="4" Sideboard="false" Name="Lightning Bolt" />
+  <Cards CatID="36025" Quantity="4" Sideboard="false" Name="Goblin Guide" />
+  <Cards CatID="36026" Quantity="1" Sideboard="false" Name="Fire/Ice" />
+  <Cards CatID="36027" Quantity="20" Sideboard="false" Name="Mountain" />
+  <Cards CatID="36028" Quantity="3" Sideboard="true" Name="Duress" />
+</Deck>`,
+	}
+
+	for format, list := range tests {
+		deck, err := ParseDeck(strings.NewReader(list))
+
+		if err != nil {
+			t.Errorf("%s: %s", format, err)
+			continue
+		}
+
+		if main := deckEntries(deck.Main); len(main) != 4 || main[0] != "**** Lightning Bolt" || main[1] != "**** Goblin Guide" {
+			t.Errorf("%s: main deck is wrong: %v", format, main)
+		}
+
+		if side := deckEntries(deck.Sideboard); len(side) != 1 || side[0] != "*** Duress" {
+			t.Errorf("%s: sideboard is wrong: %v", format, side)
+		}
+
+		unknown := deck.Resolve(NewNameIndex(deckBox()))
+
+		if len(unknown) != 0 {
+			t.Errorf("%s: unknown cards %v", format, unknown)
+		}
+	}
+}
+
+func TestParseDeckErrors(t *testing.T) {
+	for _, list := range []string{"4 Lightning Bolt\n0 Duress", "<Deck><Cards Quantity=\"0\" Name=\"Duress\" /></Deck>", "<Deck>"} {
+		if _, err := ParseDeck(strings.NewReader(list)); err == nil {
+			t.Errorf("%q should be an error", list)
+		}
+	}
+}
+
+func TestResolveUnknownCards(t *testing.T) {
+	deck, err := ParseDeck(strings.NewReader("4 Lightning Blot\n4 Black Lotus\nSB: 2 duress"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unknown := deck.Resolve(NewNameIndex(deckBox()))
+
+	if len(unknown) != 1 || unknown[0].Line != 2 || unknown[0].Name != "Black Lotus" {
+		t.Errorf("Only Black Lotus should be unknown: %v", unknown)
+	}
+
+	if deck.Main[0].Cards[0].Name != "Lightning Bolt" || deck.Sideboard[0].Cards[0].Name != "Duress" {
+		t.Errorf("Misspelled and lower case names should resolve: %+v", deck)
+	}
+}
+
+func TestResolveInexactMatches(t *testing.T) {
+	deck, err := ParseDeck(strings.NewReader("4 Lightning Blot\n4 goblin g\n2 fire/ice\nSB: 2 duress"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deck.Resolve(NewNameIndex(deckBox()))
+
+	if bolt := deck.Main[0]; bolt.Matched != "Lightning Bolt" || bolt.Distance != 1 {
+		t.Errorf("A typo should record the name it matched: %+v", bolt)
+	}
+
+	if guide := deck.Main[1]; guide.Matched != "Goblin Guide" || guide.Distance != 4 {
+		t.Errorf("A prefix should record the name it matched: %+v", guide)
+	}
+
+	inexact := []string{}
+
+	for _, e := range deck.Inexact() {
+		inexact = append(inexact, e.Name)
+	}
+
+	if !reflect.DeepEqual(inexact, []string{"Lightning Blot", "goblin g"}) {
+		t.Errorf("Only the typo and the prefix should be inexact: %v", inexact)
+	}
+}
+
+func TestDeckStats(t *testing.T) {
+	deck, err := ParseDeck(strings.NewReader(`4 Lightning Bolt
+4 Goblin Guide
+2 Boros Reckoner
+1 Fire // Ice
+2 Ornithopter
+20 Mountain
+4 Black Lotus
+Sideboard
+3 Duress`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deck.Resolve(NewNameIndex(deckBox()))
+	stats := deck.Stats()
+
+	expected := DeckStats{
+		Cards:       37,
+		Sideboard:   3,
+		Curve:       map[int]int{0: 2, 1: 8, 3: 2, 4: 1},
+		AverageCost: (8*1 + 2*3 + 4) / 13.0,
+		Colors:      map[string]int{"red": 4 + 4 + 6 + 1, "white": 6, "blue": 1},
+		Types:       map[string]int{"instant": 5, "creature": 8, "artifact": 2, "land": 20},
+	}
+
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, stats)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+)
+
+// What changed between two releases of the database. Cards are matched by
+// oracle id, and editions by multiverse id.
+type DeckboxDiff struct {
+	Added   []CardSummary `json:"added"`
+	Removed []CardSummary `json:"removed"`
+	Changed []CardChange  `json:"changed"`
+}
+
+type CardSummary struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type CardChange struct {
+	Id               string        `json:"id"`
+	Name             string        `json:"name"`
+	Fields           []FieldChange `json:"fields,omitempty"`
+	NewPrintings     []int         `json:"new_printings,omitempty"`
+	RemovedPrintings []int         `json:"removed_printings,omitempty"`
+}
+
+// A single field that differs. Edition fields are named after the
+// printing, e.g. "editions[262875].artist".
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+type field struct {
+	name  string
+	value func(Card) interface{}
+}
+
+// The oracle fields compared between versions of a card. Types and subtypes
+// are compared as a single type line.
+var cardFields = []field{
+	{"name", func(c Card) interface{} { return c.Name }},
+	{"mana_cost", func(c Card) interface{} { return c.ManaCost }},
+	{"converted_cost", func(c Card) interface{} { return c.ConvertedCost }},
+	{"type_line", func(c Card) interface{} { return c.TypeLine() }},
+	{"rules_text", func(c Card) interface{} { return nonNil(c.RulesText) }},
+	{"color_indicator", func(c Card) interface{} { return nonNil(c.ColorIndicator) }},
+	{"power", func(c Card) interface{} { return c.Power }},
+	{"toughness", func(c Card) interface{} { return c.Toughness }},
+	{"loyalty", func(c Card) interface{} { return c.Loyalty }},
+	{"special", func(c Card) interface{} { return c.Special }},
+	{"partner_card", func(c Card) interface{} { return c.PartnerCard }},
+	{"side", func(c Card) interface{} { return c.Side }},
+}
+
+type editionField struct {
+	name  string
+	value func(Edition) interface{}
+}
+
+var editionFields = []editionField{
+	{"set", func(e Edition) interface{} { return e.Set }},
+	{"rarity", func(e Edition) interface{} { return e.Rarity }},
+	{"artist", func(e Edition) interface{} { return e.Artist }},
+	{"number", func(e Edition) interface{} { return e.Number }},
+	{"watermark", func(e Edition) interface{} { return e.Watermark }},
+	{"flavor_text", func(e Edition) interface{} { return nonNil(e.FlavorText) }},
+}
+
+// Treat missing and empty lists the same
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+func summarize(card Card) CardSummary {
+	return CardSummary{Id: card.Id, Name: card.Name}
+}
+
+func DiffDeckboxes(before, after *Deckbox) DeckboxDiff {
+	diff := DeckboxDiff{Added: []CardSummary{}, Removed: []CardSummary{}, Changed: []CardChange{}}
+
+	for _, card := range before.Cards {
+		if _, found := after.ById(card.Id); !found {
+			diff.Removed = append(diff.Removed, summarize(card))
+		}
+	}
+
+	for _, card := range after.Cards {
+		beforeCard, found := before.ById(card.Id)
+
+		if !found {
+			diff.Added = append(diff.Added, summarize(card))
+			continue
+		}
+
+		if change, changed := diffCards(beforeCard, card); changed {
+			diff.Changed = append(diff.Changed, change)
+		}
+	}
+
+	sortSummaries(diff.Added)
+	sortSummaries(diff.Removed)
+
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		a, b := diff.Changed[i], diff.Changed[j]
+
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Id < b.Id
+	})
+
+	return diff
+}
+
+func sortSummaries(cards []CardSummary) {
+	sort.Slice(cards, func(i, j int) bool {
+		if cards[i].Name != cards[j].Name {
+			return cards[i].Name < cards[j].Name
+		}
+		return cards[i].Id < cards[j].Id
+	})
+}
+
+func diffCards(before, after Card) (CardChange, bool) {
+	change := CardChange{Id: after.Id, Name: after.Name}
+
+	for _, f := range cardFields {
+		a, b := f.value(before), f.value(after)
+
+		if !reflect.DeepEqual(a, b) {
+			change.Fields = append(change.Fields, FieldChange{Field: f.name, Old: a, New: b})
+		}
+	}
+
+	beforeEditions := map[int]Edition{}
+
+	for _, e := range before.Editions {
+		beforeEditions[e.MultiverseId] = e
+	}
+
+	afterEditions := map[int]bool{}
+
+	for _, e := range after.Editions {
+		afterEditions[e.MultiverseId] = true
+		beforeEdition, found := beforeEditions[e.MultiverseId]
+
+		if !found {
+			change.NewPrintings = append(change.NewPrintings, e.MultiverseId)
+			continue
+		}
+
+		for _, f := range editionFields {
+			a, b := f.value(beforeEdition), f.value(e)
+
+			if !reflect.DeepEqual(a, b) {
+				name := fmt.Sprintf("editions[%d].%s", e.MultiverseId, f.name)
+				change.Fields = append(change.Fields, FieldChange{Field: name, Old: a, New: b})
+			}
+		}
+	}
+
+	for _, e := range before.Editions {
+		if !afterEditions[e.MultiverseId] {
+			change.RemovedPrintings = append(change.RemovedPrintings, e.MultiverseId)
+		}
+	}
+
+	sort.Ints(change.NewPrintings)
+	sort.Ints(change.RemovedPrintings)
+
+	changed := len(change.Fields) > 0 || len(change.NewPrintings) > 0 || len(change.RemovedPrintings) > 0
+	return change, changed
+}
+
+func (d DeckboxDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Print the diff for people to read
+func (d DeckboxDiff) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "%d added, %d removed, %d changed\n", len(d.Added), len(d.Removed), len(d.Changed))
+
+	for _, card := range d.Added {
+		fmt.Fprintf(w, "+ %s (%s)\n", card.Name, card.Id)
+	}
+
+	for _, card := range d.Removed {
+		fmt.Fprintf(w, "- %s (%s)\n", card.Name, card.Id)
+	}
+
+	for _, card := range d.Changed {
+		fmt.Fprintf(w, "~ %s (%s)\n", card.Name, card.Id)
+
+		for _, f := range card.Fields {
+			fmt.Fprintf(w, "    %s: %s -> %s\n", f.Field, formatValue(f.Old), formatValue(f.New))
+		}
+
+		for _, id := range card.NewPrintings {
+			fmt.Fprintf(w, "    + printing %d\n", id)
+		}
+
+		for _, id := range card.RemovedPrintings {
+			fmt.Fprintf(w, "    - printing %d\n", id)
+		}
+	}
+}
+
+func formatValue(v interface{}) string {
+	blob, err := json.Marshal(v)
+
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return string(blob)
+}
+
+// frantic diff [-json] old.json new.json
+func diffCommand(args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "Print the diff as JSON")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		return fmt.Errorf("usage: diff [-json] old.json new.json")
+	}
+
+	before, err := openDeckbox(flags.Arg(0))
+
+	if err != nil {
+		return err
+	}
+
+	after, err := openDeckbox(flags.Arg(1))
+
+	if err != nil {
+		return err
+	}
+
+	diff := DiffDeckboxes(&before, &after)
+
+	if *asJSON {
+		blob, err := json.MarshalIndent(diff, "", "  ")
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(os.Stdout, string(blob))
+		return nil
+	}
+
+	diff.WriteText(os.Stdout)
+	return nil
+}
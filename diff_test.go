@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffDeckboxes(t *testing.T) {
+	before := Deckbox{Cards: []Card{
+		Card{Id: "a", Name: "Alpha", ManaCost: "{G}", Types: []string{"creature"}, RulesText: []string{"Trample"},
+			Editions: []Edition{Edition{MultiverseId: 1, Artist: "Quinton Hoover"}}},
+		Card{Id: "b", Name: "Beta", Editions: []Edition{Edition{MultiverseId: 2}}},
+		Card{Id: "c", Name: "Gamma", RulesText: nil, Editions: []Edition{Edition{MultiverseId: 3}}},
+	}}
+
+	after := Deckbox{Cards: []Card{
+		Card{Id: "a", Name: "Alpha", ManaCost: "{1}{G}", Types: []string{"creature"}, Subtypes: []string{"elf"},
+			RulesText: []string{"Trample"},
+			Editions:  []Edition{Edition{MultiverseId: 1, Artist: "Rebecca Guay"}, Edition{MultiverseId: 4}}},
+		Card{Id: "c", Name: "Gamma", RulesText: []string{}, Editions: []Edition{Edition{MultiverseId: 3}}},
+		Card{Id: "d", Name: "Delta", Editions: []Edition{Edition{MultiverseId: 5}}},
+	}}
+
+	diff := DiffDeckboxes(&before, &after)
+
+	if !reflect.DeepEqual(diff.Added, []CardSummary{CardSummary{Id: "d", Name: "Delta"}}) {
+		t.Errorf("Delta should have been added, got %+v", diff.Added)
+	}
+
+	if !reflect.DeepEqual(diff.Removed, []CardSummary{CardSummary{Id: "b", Name: "Beta"}}) {
+		t.Errorf("Beta should have been removed, got %+v", diff.Removed)
+	}
+
+	if len(diff.Changed) != 1 {
+		t.Fatalf("Only Alpha should have changed, got %+v", diff.Changed)
+	}
+
+	expected := CardChange{
+		Id:   "a",
+		Name: "Alpha",
+		Fields: []FieldChange{
+			FieldChange{Field: "mana_cost", Old: "{G}", New: "{1}{G}"},
+			FieldChange{Field: "type_line", Old: "Creature", New: "Creature — Elf"},
+			FieldChange{Field: "editions[1].artist", Old: "Quinton Hoover", New: "Rebecca Guay"},
+		},
+		NewPrintings: []int{4},
+	}
+
+	if !reflect.DeepEqual(diff.Changed[0], expected) {
+		t.Errorf("Alpha's changes were wrong: got\n%+v\ninstead of\n%+v", diff.Changed[0], expected)
+	}
+
+	var buf bytes.Buffer
+	diff.WriteText(&buf)
+
+	for _, line := range []string{"+ Delta (d)", "- Beta (b)", "~ Alpha (a)", `mana_cost: "{G}" -> "{1}{G}"`, "+ printing 4"} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("Text diff is missing %q:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestDiffIdentical(t *testing.T) {
+	box := Deckbox{Cards: []Card{Card{Id: "a", Name: "Alpha", Editions: []Edition{Edition{MultiverseId: 1}}}}}
+
+	if diff := DiffDeckboxes(&box, &box); !diff.Empty() {
+		t.Errorf("A database shouldn't differ from itself: %+v", diff)
+	}
+}
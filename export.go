@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Writing a database out in the formats other tools read
+
+type ExportOptions struct {
+	// The file or directory to write
+	Output string
+
+	// For CSV and TSV: the columns to write, a row per "card" or per
+	// "edition", what to put between a field's values, and whether to
+	// start with a byte order mark
+	Columns   []string
+	Rows      string
+	Separator string
+	BOM       bool
+}
+
+type exportFormat struct {
+	description string
+	// Where to write when -o isn't given
+	output string
+	write  func(box *Deckbox, opts ExportOptions) error
+}
+
+var exportFormats = map[string]exportFormat{
+	"cockatrice": {
+		description: "Cockatrice's card database",
+		output:      "cards.xml",
+		write:       exportCockatrice,
+	},
+	"database": {
+		description: "A copy of the database, in SQLite for .db, .sqlite or .sqlite3",
+		output:      "cards.db",
+		write: func(box *Deckbox, opts ExportOptions) error {
+			return exportDeckbox(box, opts.Output)
+		},
+	},
+	"csv": {
+		description: "Comma separated values",
+		output:      "cards.csv",
+		write:       exportCSV,
+	},
+	"mtgjson": {
+		description: "MTGJSON's AllCards.json and AllSets.json, in a directory",
+		output:      "mtgjson",
+		write:       exportMTGJSON,
+	},
+	"tsv": {
+		description: "Tab separated values",
+		output:      "cards.tsv",
+		write:       exportTSV,
+	},
+}
+
+func exportFormatNames() []string {
+	names := []string{}
+
+	for name := range exportFormats {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// frantic export [-db cards.json] [-format mtgjson] [-o path] [csv flags]
+func exportCommand(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	dbPath := flags.String("db", "cards.json", "The database to export")
+	formatName := flags.String("format", "mtgjson", "The format to write: "+strings.Join(exportFormatNames(), ", "))
+	output := flags.String("o", "", "Where to write the export, if not where the format usually goes. - is stdout for CSV and TSV")
+	columns := flags.String("columns", "", "CSV and TSV: comma separated columns to write, out of "+strings.Join(columnNames(csvColumns), ", "))
+	rows := flags.String("rows", "card", "CSV and TSV: a row per card or per edition")
+	separator := flags.String("separator", "|", "CSV and TSV: what to put between the values of a field like types")
+	bom := flags.Bool("bom", false, "CSV and TSV: start with a byte order mark, for Excel")
+	flags.Parse(args)
+
+	format, found := exportFormats[*formatName]
+
+	if !found {
+		return fmt.Errorf("unknown format %s, expected one of %s", *formatName, strings.Join(exportFormatNames(), ", "))
+	}
+
+	opts := ExportOptions{Output: *output, Rows: *rows, Separator: *separator, BOM: *bom}
+
+	if *columns != "" {
+		opts.Columns = SplitTrimSpace(*columns, ",")
+	}
+
+	if opts.Output == "" {
+		opts.Output = format.output
+	}
+
+	box, err := openDeckbox(*dbPath)
+
+	if err != nil {
+		return err
+	}
+
+	box.Sort()
+
+	return format.write(&box, opts)
+}
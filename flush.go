@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+type FlushOptions struct {
+	// Read the new file back and make sure it parses before using it
+	Verify bool
+	// Pretty print JSON arrays with this indent. JSON Lines files always
+	// have one card per line.
+	Indent string
+}
+
+// The options used by Flush. Set from the command line.
+var flushOptions = FlushOptions{Verify: true}
+
+// Replace the file at path without ever leaving a partially written file
+// behind. The blob is written to a temporary file in the same directory,
+// synced, optionally verified, and then renamed over the old file.
+func writeFileAtomic(path string, blob []byte, opts FlushOptions, verify func(string) error) error {
+	dir := filepath.Dir(path)
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
+
+	if err != nil {
+		return err
+	}
+
+	// Clean up the temporary file if anything goes wrong
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(blob)
+
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(tmp.Name(), 0644)
+
+	if err != nil {
+		return err
+	}
+
+	if opts.Verify && verify != nil {
+		err = verify(tmp.Name())
+
+		if err != nil {
+			return fmt.Errorf("%s failed verification, keeping old file: %s", path, err)
+		}
+	}
+
+	err = os.Rename(tmp.Name(), path)
+
+	if err != nil {
+		return err
+	}
+
+	syncDir(dir)
+	return nil
+}
+
+// Shift path.1 to path.2 and so on, dropping the oldest, then save a copy of
+// the current file as path.1. Run once before a run writes anything, so the
+// backups are the databases earlier runs left behind rather than the
+// flushes of this one. The file is copied, not linked, because JSON Lines
+// and SQLite databases are written in place.
+func rotateBackups(path string, backups int) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	for i := backups - 1; i >= 1; i-- {
+		err := os.Rename(backupPath(path, i), backupPath(path, i+1))
+
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return copyFile(path, backupPath(path, 1))
+}
+
+func backupPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	out, err := os.Create(dst)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+
+	if err == nil {
+		err = out.Sync()
+	}
+
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// Make a rename durable. Not every platform lets you sync a directory, so
+// errors are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+
+	if err != nil {
+		return
+	}
+
+	d.Sync()
+	d.Close()
+}
+
+// Check a flushed file parses back into the same number of cards
+func verifyDeckbox(count int) func(string) error {
+	return func(path string) error {
+		blob, err := ioutil.ReadFile(path)
+
+		if err != nil {
+			return err
+		}
+
+		var box Deckbox
+
+		err = json.Unmarshal(blob, &box)
+
+		if err != nil {
+			return err
+		}
+
+		if len(box.Cards) != count {
+			return fmt.Errorf("wrote %d cards, read back %d", count, len(box.Cards))
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotateBackups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frantic")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cards.json")
+
+	if err := rotateBackups(path, 2); err != nil {
+		t.Errorf("A missing database shouldn't be an error: %s", err)
+	}
+
+	// Each run rotates once and then flushes several times
+	for _, run := range [][]string{{"A", "B"}, {"C", "D"}, {"E", "F"}, {"G"}} {
+		err := rotateBackups(path, 2)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, id := range run {
+			box := Deckbox{Cards: []Card{Card{Id: id}}}
+			err := box.FlushWith(path, FlushOptions{Verify: true})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	expected := map[string]string{
+		path:                "G",
+		backupPath(path, 1): "F",
+		backupPath(path, 2): "D",
+	}
+
+	for p, id := range expected {
+		box, err := loadDeckBox(p)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(box.Cards) != 1 || box.Cards[0].Id != id {
+			t.Errorf("%s should hold card %s, has %+v", p, id, box.Cards)
+		}
+	}
+
+	if _, err := os.Stat(backupPath(path, 3)); !os.IsNotExist(err) {
+		t.Errorf("Only two backups should be kept")
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+
+	if len(files) != 3 {
+		t.Errorf("Temporary files were left behind: %d files in %s", len(files), dir)
+	}
+
+	// Appending to the database mustn't change the backup
+	lines := filepath.Join(dir, "cards.jsonl")
+	AppendCards(lines, []Card{Card{Id: "A"}})
+	rotateBackups(lines, 1)
+	AppendCards(lines, []Card{Card{Id: "B"}})
+
+	if backup, _ := loadDeckBox(backupPath(lines, 1)); len(backup.Cards) != 1 {
+		t.Errorf("The backup should only have the card from before the run: %+v", backup.Cards)
+	}
+}
+
+func TestFlushVerifyFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frantic")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cards.json")
+	err = ioutil.WriteFile(path, []byte(`[]`), 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writeFileAtomic(path, []byte(`[{"id": `), FlushOptions{Verify: true}, func(string) error {
+		return errors.New("truncated")
+	})
+
+	if err == nil {
+		t.Fatal("A file that fails verification shouldn't be written")
+	}
+
+	blob, _ := ioutil.ReadFile(path)
+
+	if string(blob) != `[]` {
+		t.Errorf("The old file should be untouched, has %s", blob)
+	}
+}
+
+func TestVerifyDeckbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frantic")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cards.json")
+	ioutil.WriteFile(path, []byte(`[{"id": "A"}]`), 0644)
+
+	if err := verifyDeckbox(1)(path); err != nil {
+		t.Errorf("A valid file failed verification: %s", err)
+	}
+
+	if err := verifyDeckbox(2)(path); err == nil {
+		t.Errorf("A file with the wrong number of cards passed verification")
+	}
+
+	ioutil.WriteFile(path, []byte(`[{"id": `), 0644)
+
+	if err := verifyDeckbox(1)(path); err == nil {
+		t.Errorf("A truncated file passed verification")
+	}
+}
+
+func TestFlushDeterministic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frantic")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	cards := []Card{
+		Card{Id: "b", Name: "Twin", Editions: []Edition{Edition{MultiverseId: 9}, Edition{MultiverseId: 3}}},
+		Card{Id: "a", Name: "Twin", Editions: []Edition{Edition{MultiverseId: 5}}},
+		Card{Id: "c", Name: "Apple", Editions: []Edition{Edition{MultiverseId: 7}, Edition{MultiverseId: 1}}},
+	}
+
+	reversed := []Card{}
+
+	for i := len(cards) - 1; i >= 0; i-- {
+		card := cards[i]
+		card.Editions = append([]Edition{}, card.Editions...)
+
+		for a, b := 0, len(card.Editions)-1; a < b; a, b = a+1, b-1 {
+			card.Editions[a], card.Editions[b] = card.Editions[b], card.Editions[a]
+		}
+
+		reversed = append(reversed, card)
+	}
+
+	opts := FlushOptions{Indent: "  "}
+	blobs := []string{}
+
+	for i, order := range [][]Card{cards, reversed} {
+		path := filepath.Join(dir, fmt.Sprintf("cards%d.json", i))
+		box := Deckbox{Cards: order}
+		err := box.FlushWith(path, opts)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		blob, _ := ioutil.ReadFile(path)
+		blobs = append(blobs, string(blob))
+	}
+
+	if blobs[0] != blobs[1] {
+		t.Errorf("Flushing the same cards in a different order changed the file:\n%s\n%s", blobs[0], blobs[1])
+	}
+
+	var box Deckbox
+	json.Unmarshal([]byte(blobs[0]), &box)
+
+	ids := ""
+
+	for _, card := range box.Cards {
+		ids += card.Id
+	}
+
+	if ids != "cab" {
+		t.Errorf("Cards should be ordered by name then id, got %s", ids)
+	}
+
+	if box.Cards[2].Editions[0].MultiverseId != 3 {
+		t.Errorf("Editions should be ordered by multiverse id: %+v", box.Cards[2].Editions)
+	}
+
+	if !strings.HasPrefix(blobs[0], "{\n  \"schema_version\": 1,\n") {
+		t.Errorf("Output should be indented:\n%s", blobs[0])
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// Constructed formats and Commander. The rules that change, like banned
+// lists and which sets are legal, come from a format definition file, so
+// keeping up with a new banned list is an edit to formats.json.
+
+// The newest format definition file this version of frantic reads
+const formatsVersion = 1
+
+type FormatFile struct {
+	Version int `json:"version"`
+	// When the lists were last brought up to date
+	Updated string   `json:"updated"`
+	Formats []Format `json:"formats"`
+}
+
+type Format struct {
+	Name        string `json:"name"`
+	MinDeckSize int    `json:"min_deck_size"`
+	// 0 means there's no maximum
+	MaxDeckSize  int `json:"max_deck_size,omitempty"`
+	MaxSideboard int `json:"max_sideboard"`
+	// Copies of a card allowed across the main deck and sideboard, not
+	// counting basic lands
+	MaxCopies int `json:"max_copies"`
+	// The deck has a commander and every card must fit its color identity
+	Commander bool `json:"commander,omitempty"`
+	// The sets a card must have been printed in. Empty means every set.
+	Sets       []string `json:"sets,omitempty"`
+	Banned     []string `json:"banned,omitempty"`
+	Restricted []string `json:"restricted,omitempty"`
+}
+
+func LoadFormats(path string) (*FormatFile, error) {
+	blob, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var f FormatFile
+	err = json.Unmarshal(blob, &f)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	if f.Version < 1 || f.Version > formatsVersion {
+		return nil, fmt.Errorf("%s: format definition version %d isn't supported, expected 1 to %d", path, f.Version, formatsVersion)
+	}
+
+	return &f, nil
+}
+
+func (f *FormatFile) Format(name string) (Format, bool) {
+	for _, format := range f.Formats {
+		if strings.EqualFold(format.Name, name) {
+			return format, true
+		}
+	}
+	return Format{}, false
+}
+
+func (f *FormatFile) Names() []string {
+	names := []string{}
+
+	for _, format := range f.Formats {
+		names = append(names, format.Name)
+	}
+
+	return names
+}
+
+// A card in a deck, with every copy of it counted, wherever it's listed
+// and whichever face it's listed by
+type deckCard struct {
+	name      string
+	cards     []Card
+	main      int
+	sideboard int
+}
+
+func (c *deckCard) count() int {
+	return c.main + c.sideboard
+}
+
+// The name of a whole card, e.g. "Fire // Ice" for a split card, with the
+// left half first
+func wholeName(cards []Card) string {
+	if cards[0].Special == "split" && len(cards) > 1 {
+		return strings.Join(faceNames(cards[0], cards[1]), " // ")
+	}
+	return cards[0].Name
+}
+
+// Every name a card goes by: each face's name, and a split card's whole
+// name
+func cardNameKeys(cards []Card) []string {
+	keys := []string{nameKey(wholeName(cards))}
+
+	for _, card := range cards {
+		keys = append(keys, nameKey(card.Name))
+	}
+
+	return keys
+}
+
+// The ids of a card's faces, which are the same whichever face it's
+// listed by
+func cardKey(cards []Card) string {
+	ids := []string{}
+
+	for _, card := range cards {
+		ids = append(ids, card.Id)
+	}
+
+	sort.Strings(ids)
+	return strings.Join(ids, " ")
+}
+
+func isBasicLand(card Card) bool {
+	return contains(card.Types, "basic") && contains(card.Types, "land")
+}
+
+// Cards like Relentless Rats that a deck can have any number of
+func anyNumberAllowed(card Card) bool {
+	for _, p := range card.RulesText {
+		if strings.Contains(p, "A deck can have any number of cards named") {
+			return true
+		}
+	}
+	return false
+}
+
+// The color identity of every face of a card
+func cardsIdentity(cards []Card) map[string]bool {
+	identity := map[string]bool{}
+
+	for _, card := range cards {
+		for color := range colorIdentity(card) {
+			identity[color] = true
+		}
+	}
+
+	return identity
+}
+
+func deckViolation(rule string, card *deckCard, format string, args ...interface{}) Violation {
+	v := Violation{Rule: rule, Message: fmt.Sprintf(format, args...)}
+
+	if card != nil {
+		v.Id = card.cards[0].Id
+		v.Name = card.name
+	}
+
+	return v
+}
+
+func nameSet(names []string) map[string]bool {
+	set := map[string]bool{}
+
+	for _, name := range names {
+		set[nameKey(name)] = true
+	}
+
+	return set
+}
+
+func anyIn(keys []string, set map[string]bool) bool {
+	for _, key := range keys {
+		if set[key] {
+			return true
+		}
+	}
+	return false
+}
+
+// Check a resolved deck against the format's rules. Cards Resolve couldn't
+// find are violations too, since there's no telling if they're legal.
+func (f Format) Check(deck *Deck) []Violation {
+	violations := []Violation{}
+	cards := map[string]*deckCard{}
+	order := []string{}
+	commanders := []*deckCard{}
+	main, sideboard := 0, 0
+
+	for _, e := range append(append([]DeckEntry{}, deck.Main...), deck.Sideboard...) {
+		if e.Sideboard {
+			sideboard += e.Count
+		} else {
+			main += e.Count
+		}
+
+		if len(e.Cards) == 0 {
+			v := deckViolation("unknown-card", nil, "no card named %q", e.Name)
+
+			if e.Line > 0 {
+				v.Message = fmt.Sprintf("line %d: %s", e.Line, v.Message)
+			}
+
+			violations = append(violations, v)
+			continue
+		}
+
+		key := cardKey(e.Cards)
+		c, found := cards[key]
+
+		if !found {
+			c = &deckCard{name: wholeName(e.Cards), cards: e.Cards}
+			cards[key] = c
+			order = append(order, key)
+		}
+
+		if e.Sideboard {
+			c.sideboard += e.Count
+		} else {
+			c.main += e.Count
+		}
+
+		if e.Commander {
+			commanders = append(commanders, c)
+		}
+	}
+
+	if main < f.MinDeckSize {
+		violations = append(violations, deckViolation("deck-size", nil, "the deck has %d cards, %s needs at least %d", main, f.Name, f.MinDeckSize))
+	}
+
+	if f.MaxDeckSize > 0 && main > f.MaxDeckSize {
+		violations = append(violations, deckViolation("deck-size", nil, "the deck has %d cards, %s allows at most %d", main, f.Name, f.MaxDeckSize))
+	}
+
+	if sideboard > f.MaxSideboard {
+		violations = append(violations, deckViolation("sideboard-size", nil, "the sideboard has %d cards, %s allows at most %d", sideboard, f.Name, f.MaxSideboard))
+	}
+
+	banned, restricted, sets := nameSet(f.Banned), nameSet(f.Restricted), map[string]bool{}
+
+	for _, set := range f.Sets {
+		sets[set] = true
+	}
+
+	for _, key := range order {
+		c := cards[key]
+		names := cardNameKeys(c.cards)
+
+		switch {
+		case anyIn(names, banned):
+			violations = append(violations, deckViolation("banned", c, "%s is banned in %s", c.name, f.Name))
+		case anyIn(names, restricted) && c.count() > 1:
+			violations = append(violations, deckViolation("restricted", c, "%s is restricted in %s, but there are %d copies", c.name, f.Name, c.count()))
+		case c.count() > f.MaxCopies && !isBasicLand(c.cards[0]) && !anyNumberAllowed(c.cards[0]):
+			rule := "copies"
+
+			if f.Commander {
+				rule = "singleton"
+			}
+
+			violations = append(violations, deckViolation(rule, c, "there are %d copies of %s, %s allows %d", c.count(), c.name, f.Name, f.MaxCopies))
+		}
+
+		if len(sets) > 0 && !printedIn(c.cards, sets) {
+			violations = append(violations, deckViolation("set", c, "%s hasn't been printed in a set legal in %s", c.name, f.Name))
+		}
+	}
+
+	if f.Commander {
+		violations = append(violations, f.checkCommander(commanders, cards, order)...)
+	}
+
+	return violations
+}
+
+func printedIn(cards []Card, sets map[string]bool) bool {
+	for _, card := range cards {
+		for _, e := range card.Editions {
+			if sets[e.Set] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func canBeCommander(card Card) bool {
+	if contains(card.Types, "legendary") && contains(card.Types, "creature") {
+		return true
+	}
+
+	for _, p := range card.RulesText {
+		if strings.Contains(p, "can be your commander") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasPartner(card Card) bool {
+	for _, p := range card.RulesText {
+		if p == "Partner" || strings.HasPrefix(p, "Partner (") {
+			return true
+		}
+	}
+	return false
+}
+
+// One commander, or two with partner, and every card within their color
+// identity
+func (f Format) checkCommander(commanders []*deckCard, cards map[string]*deckCard, order []string) []Violation {
+	violations := []Violation{}
+
+	switch {
+	case len(commanders) == 0:
+		return append(violations, deckViolation("commander", nil, "%s needs a commander, listed under a Commander line", f.Name))
+	case len(commanders) == 2 && hasPartner(commanders[0].cards[0]) && hasPartner(commanders[1].cards[0]):
+	case len(commanders) > 1:
+		violations = append(violations, deckViolation("commander", nil, "only commanders with partner can share a deck, but there are %d", len(commanders)))
+	}
+
+	identity := map[string]bool{}
+
+	for _, c := range commanders {
+		if !canBeCommander(c.cards[0]) {
+			violations = append(violations, deckViolation("commander", c, "%s isn't a legendary creature", c.name))
+		}
+
+		for color := range cardsIdentity(c.cards) {
+			identity[color] = true
+		}
+	}
+
+	for _, key := range order {
+		c := cards[key]
+		outside := map[string]bool{}
+
+		for color := range cardsIdentity(c.cards) {
+			if !identity[color] {
+				outside[color] = true
+			}
+		}
+
+		if len(outside) > 0 {
+			violations = append(violations, deckViolation("color-identity", c, "%s is %s, outside the commander's color identity",
+				c.name, strings.Join(colorCodes(outside), "")))
+		}
+	}
+
+	return violations
+}
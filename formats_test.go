@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func formatBox() *Deckbox {
+	box := deckBox()
+	extra := []Card{
+		Card{Name: "Ponder", Types: []string{"sorcery"}, ManaCost: "{U}", ConvertedCost: 1},
+		Card{Name: "Black Lotus", Types: []string{"artifact"}, ManaCost: "{0}"},
+		Card{Name: "Aurelia, the Warleader", Types: []string{"legendary", "creature"}, ManaCost: "{2}{R}{R}{W}{W}", ConvertedCost: 6},
+		Card{Name: "Relentless Rats", Types: []string{"creature"}, ManaCost: "{1}{B}{B}", ConvertedCost: 3,
+			RulesText: []string{"Relentless Rats gets +1/+1 for each other creature on the battlefield named Relentless Rats.",
+				"A deck can have any number of cards named Relentless Rats."}},
+		Card{Name: "Rakdos Guildmage", Types: []string{"creature"}, ManaCost: "{B/R}{B/R}", ConvertedCost: 2,
+			RulesText: []string{"{3}{B}, Discard a card: Target creature gets -2/-2 until end of turn."}},
+		Card{Name: "Boros Guildgate", Types: []string{"land"},
+			RulesText: []string{"Boros Guildgate enters the battlefield tapped.", "{T}: Add {R} or {W} to your mana pool."}},
+		Card{Name: "Prophetic Prism", Types: []string{"artifact"}, ManaCost: "{2}", ConvertedCost: 2,
+			RulesText: []string{"{1}, {T}: Add one mana of any color to your mana pool. (This is {W}, {U}, {B}, {R} or {G}.)"}},
+	}
+
+	for i := range extra {
+		extra[i].Id = OracleId(extra[i].Name)
+	}
+
+	box.Cards = append(box.Cards, extra...)
+
+	for i := range box.Cards {
+		box.Cards[i].Editions = []Edition{Edition{MultiverseId: i + 1, Set: "Alpha"}}
+	}
+
+	box.Cards[0].Editions = append(box.Cards[0].Editions, Edition{MultiverseId: 100, Set: "Magic 2010"})
+	return box
+}
+
+func checkDeck(t *testing.T, format Format, list string) []string {
+	deck, err := ParseDeck(strings.NewReader(list))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deck.Resolve(NewNameIndex(formatBox()))
+	rules := []string{}
+
+	for _, v := range format.Check(deck) {
+		rules = append(rules, v.Rule+" "+v.Name)
+	}
+
+	sort.Strings(rules)
+	return rules
+}
+
+func TestLoadFormats(t *testing.T) {
+	formats, err := LoadFormats("formats.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := formats.Names(); !reflect.DeepEqual(names, []string{"standard", "modern", "legacy", "vintage", "commander"}) {
+		t.Errorf("Unexpected formats %v", names)
+	}
+
+	if f, found := formats.Format("Commander"); !found || !f.Commander || f.MaxCopies != 1 {
+		t.Errorf("Commander is wrong: %+v", f)
+	}
+
+	if f, _ := formats.Format("modern"); len(f.Sets) == 0 || f.Sets[0] != "Eighth Edition" || !contains(f.Sets, "Oath of the Gatewatch") {
+		t.Errorf("Modern should be every set from Eighth Edition on: %v", f.Sets)
+	}
+
+	for _, name := range []string{"legacy", "vintage"} {
+		if f, _ := formats.Format(name); !contains(f.Banned, "Contract from Below") || !contains(f.Banned, "Amulet of Quoz") {
+			t.Errorf("%s should ban the ante cards: %v", name, f.Banned)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "frantic")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "formats.json")
+	ioutil.WriteFile(path, []byte(fmt.Sprintf(`{"version": %d, "formats": []}`, formatsVersion+1)), 0644)
+
+	if _, err := LoadFormats(path); err == nil {
+		t.Errorf("Newer format definitions should be an error")
+	}
+}
+
+func TestWholeName(t *testing.T) {
+	life := Card{Name: "Life", Special: "split", Side: "a"}
+	death := Card{Name: "Death", Special: "split", Side: "b"}
+
+	if name := wholeName([]Card{death, life}); name != "Life // Death" {
+		t.Errorf("The left half should come first, got %s", name)
+	}
+
+	// Without sides, split halves are in name order
+	life.Side, death.Side = "", ""
+
+	if name := wholeName([]Card{life, death}); name != "Death // Life" {
+		t.Errorf("Expected name order without sides, got %s", name)
+	}
+}
+
+func TestCheckConstructed(t *testing.T) {
+	modern := Format{Name: "modern", MinDeckSize: 60, MaxSideboard: 15, MaxCopies: 4, Banned: []string{"Ponder", "Fire // Ice"}}
+
+	if rules := checkDeck(t, modern, "4 Lightning Bolt\n4 Goblin Guide\n12 Relentless Rats\n40 Mountain\nSideboard\n4 Duress"); len(rules) != 0 {
+		t.Errorf("Deck should be legal: %v", rules)
+	}
+
+	rules := checkDeck(t, modern, `4 Lightning Bolt
+4 Goblin Guide
+1 Ponder
+1 Ice
+1 Black Lotus
+4 Black Lotus
+44 Mountain
+Sideboard
+1 Lightning Bolt
+4 Duress
+4 Ornithopter
+4 Boros Reckoner
+4 Relentless Rats`)
+
+	expected := []string{"banned Fire // Ice", "banned Ponder", "copies Black Lotus", "copies Lightning Bolt", "deck-size ", "sideboard-size "}
+
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("Expected %v, got %v", expected, rules)
+	}
+
+	vintage := Format{Name: "vintage", MinDeckSize: 60, MaxSideboard: 15, MaxCopies: 4, Restricted: []string{"Black Lotus", "Ponder"}}
+
+	if rules := checkDeck(t, vintage, "1 Black Lotus\n1 Ponder\n58 Mountain\nSB: 1 Ponder\n1 Chaos Orb"); !reflect.DeepEqual(rules, []string{"restricted Ponder", "unknown-card "}) {
+		t.Errorf("Only Ponder should be over its restriction: %v", rules)
+	}
+
+	standard := Format{Name: "standard", MinDeckSize: 60, MaxSideboard: 15, MaxCopies: 4, Sets: []string{"Magic 2010"}}
+
+	if rules := checkDeck(t, standard, "4 Lightning Bolt\n4 Goblin Guide\n52 Mountain"); !reflect.DeepEqual(rules, []string{"set Goblin Guide", "set Mountain"}) {
+		t.Errorf("Only Lightning Bolt is in Magic 2010: %v", rules)
+	}
+}
+
+func TestCheckCommander(t *testing.T) {
+	commander := Format{Name: "commander", MinDeckSize: 100, MaxDeckSize: 100, MaxCopies: 1, Commander: true, Banned: []string{"Black Lotus"}}
+	legal := "Commander\n1 Aurelia, the Warleader\n\nDeck\n1 Lightning Bolt\n1 Boros Reckoner\n1 Boros Guildgate\n1 Prophetic Prism\n95 Mountain"
+
+	if rules := checkDeck(t, commander, legal); len(rules) != 0 {
+		t.Errorf("Deck should be legal: %v", rules)
+	}
+
+	rules := checkDeck(t, commander, `Commander
+1 Boros Reckoner
+
+Deck
+2 Lightning Bolt
+1 Duress
+1 Rakdos Guildmage
+1 Fire // Ice
+1 Black Lotus
+93 Mountain
+Sideboard
+1 Ornithopter`)
+
+	expected := []string{
+		"banned Black Lotus",
+		"color-identity Duress",
+		"color-identity Fire // Ice",
+		"color-identity Rakdos Guildmage",
+		"commander Boros Reckoner",
+		"sideboard-size ",
+		"singleton Lightning Bolt",
+	}
+
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("Expected %v, got %v", expected, rules)
+	}
+
+	if rules := checkDeck(t, commander, "99 Mountain\n1 Lightning Bolt"); !reflect.DeepEqual(rules, []string{"commander "}) {
+		t.Errorf("A deck without a commander should say so: %v", rules)
+	}
+}
+
+func TestColorIdentity(t *testing.T) {
+	box := formatBox()
+
+	tests := map[string][]string{
+		"Rakdos Guildmage": {"B", "R"},
+		"Boros Guildgate":  {"W", "R"},
+		"Prophetic Prism":  {},
+		"Mountain":         {},
+	}
+
+	for name, expected := range tests {
+		card, _ := box.ById(OracleId(name))
+
+		if identity := colorCodes(colorIdentity(card)); !reflect.DeepEqual(identity, expected) {
+			t.Errorf("%s should have identity %v, not %v", name, expected, identity)
+		}
+	}
+}
@@ -1,10 +1,11 @@
 package main
 
 import (
-	"code.google.com/p/go.net/html"
 	"crypto/md5"
 	"fmt"
+	"golang.org/x/net/html"
 	"io"
+	"log"
 	"math"
 	"net/http"
 	"net/url"
@@ -21,6 +22,7 @@ const (
 	prefixRight  = "#ctl00_ctl00_ctl00_MainContent_SubContent_SubContent_ctl10_"
 	gathererUrl  = "http://gatherer.wizards.com/Pages/Card/Details.aspx?multiverseid=%d"
 	searchUrl    = "http://gatherer.wizards.com/Pages/Search/Default.aspx?output=compact&action=advanced&special=true&cmc=|>%%3d[0]|<%%3d[0]&page=%d"
+	imageUrl     = "http://gatherer.wizards.com/Handlers/Image.ashx?multiverseid=%d&type=card"
 )
 
 type Card struct {
@@ -28,10 +30,11 @@ type Card struct {
 	Id             string    `json:"id"`
 	Types          []string  `json:"types"`
 	Subtypes       []string  `json:"subtypes,omitempty"`
-	ConvertedCost  int       `json:"converted_cost"`
+	ConvertedCost  float64   `json:"converted_cost"`
 	ManaCost       string    `json:"mana_cost"`
 	Special        string    `json:"special,omitempty"` //'flip', 'double-faced', 'split'
 	PartnerCard    string    `json:"partner_card,omitempty"`
+	Side           string    `json:"side,omitempty"` //'a' for the left half or front face, 'b' for the other
 	RulesText      []string  `json:"rules_text"`
 	ColorIndicator []string  `json:"color_indicator,omitempty"`
 	Power          string    `json:"power,omitempty"`
@@ -50,10 +53,40 @@ type Edition struct {
 	Number       string   `json:"number,omitempty"`
 }
 
+// The card's type line as printed, e.g. "Creature — Human Werewolf"
+func (c Card) TypeLine() string {
+	line := capitalize(strings.Join(c.Types, " "))
+
+	if len(c.Subtypes) > 0 {
+		line += " — " + capitalize(strings.Join(c.Subtypes, " "))
+	}
+
+	return line
+}
+
+// Upper case the first letter of every word
+func capitalize(s string) string {
+	words := strings.Split(s, " ")
+
+	for i, word := range words {
+		if word != "" {
+			r := []rune(word)
+			words[i] = strings.ToUpper(string(r[0])) + string(r[1:])
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
 func (c Card) ImageURl() string {
 	return "http://gatherer.wizards.com/Handlers/Image.ashx?multiverseid="
 }
 
+// The printing's card image on Gatherer
+func (e Edition) ImageURL() string {
+	return fmt.Sprintf(imageUrl, e.MultiverseId)
+}
+
 func extractString(n *html.Node, pattern string) string {
 	if div, found := Find(n, pattern); found {
 		return strings.TrimSpace(Flatten(div))
@@ -63,71 +96,8 @@ func extractString(n *html.Node, pattern string) string {
 }
 
 func manaSymbol(alt string) string {
-	switch alt {
-	case "0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12", "13", "14", "15":
-		return "{" + alt + "}"
-	case "Phyrexian":
-		return "{P}"
-	case "Phyrexian Green":
-		return "{G/P}"
-	case "Phyrexian Red":
-		return "{R/P}"
-	case "Phyrexian Blue":
-		return "{U/P}"
-	case "Phyrexian Black":
-		return "{B/P}"
-	case "Phyrexian White":
-		return "{W/P}"
-	case "White or Blue":
-		return "{W/U}"
-	case "White or Black":
-		return "{W/B}"
-	case "Blue or Black":
-		return "{U/B}"
-	case "Blue or Red":
-		return "{U/R}"
-	case "Black or Red":
-		return "{B/R}"
-	case "Black or Green":
-		return "{B/G}"
-	case "Red or Green":
-		return "{R/G}"
-	case "Red or White":
-		return "{R/W}"
-	case "Green or White":
-		return "{G/W}"
-	case "Green or Blue":
-		return "{G/U}"
-	case "Two or White":
-		return "{2/W}"
-	case "Two or Blue":
-		return "{2/U}"
-	case "Two or Black":
-		return "{2/B}"
-	case "Two or Red":
-		return "{2/R}"
-	case "Two or Green ":
-		return "{2/G}"
-	case "Variable Colorless":
-		return "{X}"
-	case "Snow":
-		return "{S}"
-	case "Green":
-		return "{G}"
-	case "Red":
-		return "{R}"
-	case "Blue":
-		return "{U}"
-	case "Black":
-		return "{B}"
-	case "White":
-		return "{W}"
-	case "Tap":
-		return "{T}"
-	case "Untap":
-		return "{Q}"
-	case "[chaos]":
-		return "{C}"
+	if s, found := symbols.Lookup(strings.TrimSpace(alt)); found {
+		return s.Symbol
 	}
 	return ""
 }
@@ -236,6 +206,42 @@ func extractInt(n *html.Node, pattern string) int {
 	return number
 }
 
+func extractFloat(n *html.Node, pattern string) (float64, bool) {
+	div, found := Find(n, pattern)
+
+	if !found {
+		return 0, false
+	}
+
+	number, err := strconv.ParseFloat(strings.TrimSpace(Flatten(div)), 64)
+
+	if err != nil {
+		return 0, false
+	}
+
+	return number, true
+}
+
+// Compute the converted mana cost from the card's mana cost and check it
+// against the value Gatherer shows. If the cost has symbols we don't know
+// about, fall back to Gatherer's value.
+func extractConvertedCost(n *html.Node, prefix string, card Card) float64 {
+	scraped, found := extractFloat(n, prefix+"cmcRow .value")
+	computed, err := symbols.ConvertedCost(card.ManaCost)
+
+	if err != nil {
+		log.Printf("WARNING: Can't compute converted cost for %s: %s", card.Name, err)
+		return scraped
+	}
+
+	if found && scraped != computed {
+		log.Printf("WARNING: Converted cost mismatch for %s %s: Gatherer says %v, computed %v",
+			card.Name, card.ManaCost, scraped, computed)
+	}
+
+	return computed
+}
+
 func extractId(n *html.Node, pattern string) int {
 	img, found := Find(n, pattern)
 
@@ -339,8 +345,8 @@ func parseCard(doc *html.Node, prefix string) Card {
 	card := Card{}
 	card.Name = extractString(doc, prefix+"nameRow .value")
 	card.ManaCost = extractManaCost(doc, prefix)
-	card.Id = hash(card.Name + card.ManaCost)
-	card.ConvertedCost = extractInt(doc, prefix+"cmcRow .value")
+	card.Id = OracleId(card.Name)
+	card.ConvertedCost = extractConvertedCost(doc, prefix, card)
 	card.RulesText = extractText(doc, prefix+"textRow .value .cardtextbox")
 	card.Loyalty = extractInt(doc, prefix+"ptRow .value")
 	card.ColorIndicator = extractColorIndicator(doc, prefix)
@@ -414,11 +420,29 @@ func ParseCards(page io.Reader, multiverseid int) ([]Card, error) {
 		a := parseCard(doc, prefixA)
 		b := parseCard(doc, prefixB)
 
+		if a.Id == b.Id {
+			b.Id = faceId(b.Name, 1)
+		}
+
 		a.PartnerCard = b.Id
 		b.PartnerCard = a.Id
 
+		// Each half of a split card has its own cost, but the back face of
+		// a double-faced or flip card uses the converted cost of the front.
+		if special != "split" {
+			b.ConvertedCost = a.ConvertedCost
+		}
+
 		a.Special = special
 		b.Special = special
+		a.Side, b.Side = "a", "b"
+
+		// Gatherer shows the half it was asked for first, but the title
+		// names a split card in printed order
+		if special == "split" && strings.HasPrefix(extractString(doc, "title"), b.Name+" // ") {
+			a.Side, b.Side = "b", "a"
+		}
+
 		return []Card{a, b}, nil
 	} else {
 		return []Card{parseCard(doc, prefixSingle)}, nil
@@ -487,7 +511,7 @@ func ParseSearch(page io.Reader) ([]SearchResult, int, error) {
 
 		results = append(results, SearchResult{
 			Name:         name,
-			Id:           hash(name),
+			Id:           OracleId(name),
 			MultiverseId: multiverseid,
 		})
 	}
@@ -35,7 +35,7 @@ func TestSearchResults(t *testing.T) {
 
 	card := results[0]
 
-	expected := SearchResult{Name: "Academy at Tolaria West", MultiverseId: 198073, Id: "d4d9a0bf18e13b326a3ca19c8283d28b"}
+	expected := SearchResult{Name: "Academy at Tolaria West", MultiverseId: 198073, Id: "ba5afe92ff413f18c34641870bfbf636"}
 
 	if !reflect.DeepEqual(card, expected) {
 		t.Errorf("Cards did not match: Got: \n%+v\ninstead of\n%+v", card, expected)
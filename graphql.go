@@ -0,0 +1,496 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// A GraphQL view of the same snapshot the JSON API serves, so a client can
+// fetch a card with its partner, printings, sets and artists in one request.
+// Each request resolves against the snapshot that was current when it
+// arrived, even if the database is reloaded halfway through.
+
+const graphSchema = `
+schema {
+	query: Query
+}
+
+type Query {
+	# A card by oracle id, or by name. Fuzzy names are matched like the show
+	# command does.
+	card(id: ID, name: String, fuzzy: Boolean): Card
+	# Cards matching a search query, e.g. "t:creature cmc>=3"
+	cards(query: String, first: Int, offset: Int): CardList!
+	# The cards printed under a multiverse id. Both halves of a split card
+	# share one.
+	multiverse(id: Int!): [Card!]!
+	set(name: String!): Set
+	sets: [Set!]!
+	artist(name: String!): Artist
+	artists: [Artist!]!
+}
+
+type CardList {
+	total: Int!
+	hasMore: Boolean!
+	cards: [Card!]!
+}
+
+type Card {
+	id: ID!
+	name: String!
+	typeLine: String!
+	types: [String!]!
+	subtypes: [String!]!
+	manaCost: String!
+	convertedCost: Float!
+	special: String
+	# a for the left half of a split card or the front face of a flip or
+	# double-faced card, b for the other
+	side: String
+	rulesText: [String!]!
+	colorIndicator: [String!]!
+	power: String
+	toughness: String
+	loyalty: Int
+	# The other face of a double-faced or flip card, or the other half of a
+	# split card
+	partner: Card
+	printings(set: String): [Printing!]!
+}
+
+type Printing {
+	multiverseId: Int!
+	card: Card!
+	set: Set
+	artist: Artist
+	rarity: String
+	number: String
+	watermark: String
+	flavorText: [String!]!
+}
+
+type Set {
+	name: String!
+	printingCount: Int!
+	printings: [Printing!]!
+	cards: [Card!]!
+}
+
+type Artist {
+	name: String!
+	printingCount: Int!
+	printings: [Printing!]!
+	# The cards this artist has illustrated, leaving out the card with id
+	# except
+	cards(except: ID): [Card!]!
+}
+`
+
+// A single printing of a card
+type printing struct {
+	card    Card
+	edition Edition
+}
+
+// Group every printing by a value of its edition, keeping the box's order
+func groupEditions(box *Deckbox, value func(Edition) string) map[string][]printing {
+	groups := map[string][]printing{}
+
+	for _, card := range box.Cards {
+		for _, e := range card.Editions {
+			if v := value(e); v != "" {
+				groups[v] = append(groups[v], printing{card: card, edition: e})
+			}
+		}
+	}
+
+	return groups
+}
+
+type snapshotKey struct{}
+
+func snapshotFrom(ctx context.Context) *snapshot {
+	return ctx.Value(snapshotKey{}).(*snapshot)
+}
+
+// The schema is recursive, e.g. printing { card { printings { card ... } } },
+// so queries are limited to this many nested fields to bound the work one
+// request can ask for
+const graphMaxDepth = 8
+
+func newGraphSchema() *graphql.Schema {
+	return graphql.MustParseSchema(graphSchema, &graphRoot{}, graphql.MaxDepth(graphMaxDepth))
+}
+
+type graphRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// POST /graphql with a JSON body, or GET /graphql?query=...&variables=...
+func (s *Server) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphRequest
+
+	switch r.Method {
+	case "GET", "HEAD":
+		params := r.URL.Query()
+		req.Query = params.Get("query")
+		req.OperationName = params.Get("operationName")
+
+		if v := params.Get("variables"); v != "" {
+			err := json.Unmarshal([]byte(v), &req.Variables)
+
+			if err != nil {
+				writeError(w, badRequest("variables should be a JSON object: %s", err))
+				return
+			}
+		}
+	case "POST":
+		err := json.NewDecoder(r.Body).Decode(&req)
+
+		if err != nil {
+			writeError(w, badRequest("request should be a JSON object: %s", err))
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		writeError(w, apiError{status: http.StatusMethodNotAllowed, message: "only GET and POST are supported"})
+		return
+	}
+
+	if req.Query == "" {
+		writeError(w, badRequest("query is required"))
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), snapshotKey{}, s.current())
+	response := s.graph.Exec(ctx, req.Query, req.OperationName, req.Variables)
+	blob, err := json.Marshal(response)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(blob, '\n'))
+}
+
+type graphRoot struct{}
+
+func (graphRoot) Card(ctx context.Context, args struct {
+	Id    *graphql.ID
+	Name  *string
+	Fuzzy *bool
+}) (*cardResolver, error) {
+	snap := snapshotFrom(ctx)
+
+	switch {
+	case args.Id != nil && args.Name != nil:
+		return nil, fmt.Errorf("card takes an id or a name, not both")
+	case args.Id != nil:
+		card, found := snap.box.ById(string(*args.Id))
+
+		if !found {
+			return nil, nil
+		}
+
+		return &cardResolver{snap, card}, nil
+	case args.Name != nil:
+		if args.Fuzzy == nil || !*args.Fuzzy {
+			match, found := snap.names.Lookup(*args.Name)
+
+			if !found {
+				return nil, nil
+			}
+
+			return &cardResolver{snap, match.Cards[0]}, nil
+		}
+
+		match, err := snap.names.Find(*args.Name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &cardResolver{snap, match.Cards[0]}, nil
+	}
+
+	return nil, fmt.Errorf("card needs an id or a name")
+}
+
+func (graphRoot) Cards(ctx context.Context, args struct {
+	Query  *string
+	First  *int32
+	Offset *int32
+}) (*cardListResolver, error) {
+	snap := snapshotFrom(ctx)
+	q := Query(AndQuery{})
+
+	if args.Query != nil {
+		parsed, err := ParseQuery(*args.Query)
+
+		if err != nil {
+			return nil, err
+		}
+
+		q = parsed
+	}
+
+	first, offset := defaultPerPage, 0
+
+	if args.First != nil {
+		first = int(*args.First)
+
+		if first < 1 || first > maxPerPage {
+			return nil, fmt.Errorf("first should be between 1 and %d, not %d", maxPerPage, first)
+		}
+	}
+
+	if args.Offset != nil {
+		offset = int(*args.Offset)
+
+		if offset < 0 {
+			return nil, fmt.Errorf("offset can't be negative")
+		}
+	}
+
+	matches := snap.box.Search(q)
+	start, end := offset, offset+first
+
+	if start > len(matches) {
+		start = len(matches)
+	}
+
+	if end > len(matches) {
+		end = len(matches)
+	}
+
+	return &cardListResolver{
+		total:   len(matches),
+		hasMore: end < len(matches),
+		cards:   cardResolvers(snap, matches[start:end]),
+	}, nil
+}
+
+func (graphRoot) Multiverse(ctx context.Context, args struct{ Id int32 }) []*cardResolver {
+	snap := snapshotFrom(ctx)
+	return cardResolvers(snap, snap.box.ByMultiverseId(int(args.Id)))
+}
+
+func (graphRoot) Set(ctx context.Context, args struct{ Name string }) *setResolver {
+	snap := snapshotFrom(ctx)
+
+	if _, found := snap.bySet[args.Name]; !found {
+		return nil
+	}
+
+	return &setResolver{snap, args.Name}
+}
+
+func (graphRoot) Sets(ctx context.Context) []*setResolver {
+	snap := snapshotFrom(ctx)
+	sets := []*setResolver{}
+
+	for _, set := range snap.sets {
+		sets = append(sets, &setResolver{snap, set.Name})
+	}
+
+	return sets
+}
+
+func (graphRoot) Artist(ctx context.Context, args struct{ Name string }) *artistResolver {
+	snap := snapshotFrom(ctx)
+
+	if _, found := snap.byArtist[args.Name]; !found {
+		return nil
+	}
+
+	return &artistResolver{snap, args.Name}
+}
+
+func (graphRoot) Artists(ctx context.Context) []*artistResolver {
+	snap := snapshotFrom(ctx)
+	artists := []*artistResolver{}
+
+	for _, artist := range snap.artists {
+		artists = append(artists, &artistResolver{snap, artist.Name})
+	}
+
+	return artists
+}
+
+type cardListResolver struct {
+	total   int
+	hasMore bool
+	cards   []*cardResolver
+}
+
+func (l *cardListResolver) Total() int32           { return int32(l.total) }
+func (l *cardListResolver) HasMore() bool          { return l.hasMore }
+func (l *cardListResolver) Cards() []*cardResolver { return l.cards }
+
+type cardResolver struct {
+	snap *snapshot
+	card Card
+}
+
+func cardResolvers(snap *snapshot, cards []Card) []*cardResolver {
+	resolvers := []*cardResolver{}
+
+	for _, card := range cards {
+		resolvers = append(resolvers, &cardResolver{snap, card})
+	}
+
+	return resolvers
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func orEmpty(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func (c *cardResolver) Id() graphql.ID           { return graphql.ID(c.card.Id) }
+func (c *cardResolver) Name() string             { return c.card.Name }
+func (c *cardResolver) TypeLine() string         { return c.card.TypeLine() }
+func (c *cardResolver) Types() []string          { return orEmpty(c.card.Types) }
+func (c *cardResolver) Subtypes() []string       { return orEmpty(c.card.Subtypes) }
+func (c *cardResolver) ManaCost() string         { return c.card.ManaCost }
+func (c *cardResolver) ConvertedCost() float64   { return c.card.ConvertedCost }
+func (c *cardResolver) Special() *string         { return optional(c.card.Special) }
+func (c *cardResolver) Side() *string            { return optional(c.card.Side) }
+func (c *cardResolver) RulesText() []string      { return orEmpty(c.card.RulesText) }
+func (c *cardResolver) ColorIndicator() []string { return orEmpty(c.card.ColorIndicator) }
+func (c *cardResolver) Power() *string           { return optional(c.card.Power) }
+func (c *cardResolver) Toughness() *string       { return optional(c.card.Toughness) }
+
+func (c *cardResolver) Loyalty() *int32 {
+	if c.card.Loyalty == 0 {
+		return nil
+	}
+
+	loyalty := int32(c.card.Loyalty)
+	return &loyalty
+}
+
+func (c *cardResolver) Partner() *cardResolver {
+	partner, found := c.snap.box.ById(c.card.PartnerCard)
+
+	if c.card.PartnerCard == "" || !found {
+		return nil
+	}
+
+	return &cardResolver{c.snap, partner}
+}
+
+func (c *cardResolver) Printings(args struct{ Set *string }) []*printingResolver {
+	printings := []*printingResolver{}
+
+	for _, e := range c.card.Editions {
+		if args.Set == nil || e.Set == *args.Set {
+			printings = append(printings, &printingResolver{c.snap, printing{c.card, e}})
+		}
+	}
+
+	return printings
+}
+
+type printingResolver struct {
+	snap *snapshot
+	p    printing
+}
+
+func printingResolvers(snap *snapshot, printings []printing) []*printingResolver {
+	resolvers := []*printingResolver{}
+
+	for _, p := range printings {
+		resolvers = append(resolvers, &printingResolver{snap, p})
+	}
+
+	return resolvers
+}
+
+func (p *printingResolver) MultiverseId() int32  { return int32(p.p.edition.MultiverseId) }
+func (p *printingResolver) Card() *cardResolver  { return &cardResolver{p.snap, p.p.card} }
+func (p *printingResolver) Rarity() *string      { return optional(p.p.edition.Rarity) }
+func (p *printingResolver) Number() *string      { return optional(p.p.edition.Number) }
+func (p *printingResolver) Watermark() *string   { return optional(p.p.edition.Watermark) }
+func (p *printingResolver) FlavorText() []string { return orEmpty(p.p.edition.FlavorText) }
+
+func (p *printingResolver) Set() *setResolver {
+	if p.p.edition.Set == "" {
+		return nil
+	}
+	return &setResolver{p.snap, p.p.edition.Set}
+}
+
+func (p *printingResolver) Artist() *artistResolver {
+	if p.p.edition.Artist == "" {
+		return nil
+	}
+	return &artistResolver{p.snap, p.p.edition.Artist}
+}
+
+// The distinct cards among some printings, in order
+func printedCards(snap *snapshot, printings []printing, except string) []*cardResolver {
+	seen := map[string]bool{except: true}
+	cards := []*cardResolver{}
+
+	for _, p := range printings {
+		if !seen[p.card.Id] {
+			seen[p.card.Id] = true
+			cards = append(cards, &cardResolver{snap, p.card})
+		}
+	}
+
+	return cards
+}
+
+type setResolver struct {
+	snap *snapshot
+	name string
+}
+
+func (s *setResolver) Name() string         { return s.name }
+func (s *setResolver) PrintingCount() int32 { return int32(len(s.snap.bySet[s.name])) }
+func (s *setResolver) Printings() []*printingResolver {
+	return printingResolvers(s.snap, s.snap.bySet[s.name])
+}
+func (s *setResolver) Cards() []*cardResolver { return printedCards(s.snap, s.snap.bySet[s.name], "") }
+
+type artistResolver struct {
+	snap *snapshot
+	name string
+}
+
+func (a *artistResolver) Name() string         { return a.name }
+func (a *artistResolver) PrintingCount() int32 { return int32(len(a.snap.byArtist[a.name])) }
+
+func (a *artistResolver) Printings() []*printingResolver {
+	return printingResolvers(a.snap, a.snap.byArtist[a.name])
+}
+
+func (a *artistResolver) Cards(args struct{ Except *graphql.ID }) []*cardResolver {
+	except := ""
+
+	if args.Except != nil {
+		except = string(*args.Except)
+	}
+
+	return printedCards(a.snap, a.snap.byArtist[a.name], except)
+}
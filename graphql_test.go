@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type graphResult struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func graphQuery(t *testing.T, s *Server, query string, variables map[string]interface{}) graphResult {
+	body, _ := json.Marshal(graphRequest{Query: query, Variables: variables})
+	r := httptest.NewRequest("POST", "/graphql", strings.NewReader(string(body)))
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, r)
+
+	if w.Code != 200 {
+		t.Fatalf("%s: %d %s", query, w.Code, w.Body)
+	}
+
+	var result graphResult
+	err := json.Unmarshal(w.Body.Bytes(), &result)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+func TestGraphQLCard(t *testing.T) {
+	s, _, cleanup := testServer(t)
+	defer cleanup()
+
+	result := graphQuery(t, s, `query($name: String!) {
+		card(name: $name, fuzzy: true) {
+			name
+			partner { name }
+			printings { multiverseId set { name printingCount } artist { cards(except: $id) { name } } }
+		}
+	}`, map[string]interface{}{"name": "huntmaster of the fels"})
+
+	if len(result.Errors) == 0 || !strings.Contains(result.Errors[0].Message, "$id") {
+		t.Errorf("Undefined variables should be an error: %+v", result.Errors)
+	}
+
+	result = graphQuery(t, s, `query($name: String!, $id: ID) {
+		card(name: $name, fuzzy: true) {
+			name
+			partner { name }
+			printings { multiverseId set { name printingCount } artist { cards(except: $id) { name } } }
+		}
+	}`, map[string]interface{}{"name": "huntmaster of the fels", "id": OracleId("Lord of the Pit")})
+
+	if len(result.Errors) != 0 {
+		t.Fatalf("%+v", result.Errors)
+	}
+
+	var data struct {
+		Card struct {
+			Name      string
+			Partner   struct{ Name string }
+			Printings []struct {
+				MultiverseId int
+				Set          struct {
+					Name          string
+					PrintingCount int
+				}
+				Artist struct {
+					Cards []struct{ Name string }
+				}
+			}
+		}
+	}
+
+	json.Unmarshal(result.Data, &data)
+	card := data.Card
+
+	if card.Name != "Huntmaster of the Fells" || card.Partner.Name != "Ravager of the Fells" {
+		t.Errorf("Expected Huntmaster and its partner, got %+v", card)
+	}
+
+	if len(card.Printings) != 1 || card.Printings[0].MultiverseId != 100 || card.Printings[0].Set.PrintingCount != 8 {
+		t.Fatalf("Printing is wrong: %+v", card.Printings)
+	}
+
+	for _, other := range card.Printings[0].Artist.Cards {
+		if other.Name == "Lord of the Pit" {
+			t.Errorf("The excepted card shouldn't be among the artist's cards")
+		}
+	}
+
+	if n := len(card.Printings[0].Artist.Cards); n != 8 {
+		t.Errorf("The artist should have 8 other cards, not %d", n)
+	}
+}
+
+func TestGraphQLCards(t *testing.T) {
+	s, _, cleanup := testServer(t)
+	defer cleanup()
+
+	result := graphQuery(t, s, `{
+		cards(query: "t:creature", first: 3, offset: 6) { total hasMore cards { name } }
+		multiverse(id: 102) { name }
+		set(name: "Tempest") { cards { name typeLine } }
+		missing: card(id: "nope") { name }
+	}`, nil)
+
+	if len(result.Errors) != 0 {
+		t.Fatalf("%+v", result.Errors)
+	}
+
+	var data struct {
+		Cards struct {
+			Total   int
+			HasMore bool
+			Cards   []struct{ Name string }
+		}
+		Multiverse []struct{ Name string }
+		Set        struct {
+			Cards []struct{ Name, TypeLine string }
+		}
+		Missing *struct{ Name string }
+	}
+
+	json.Unmarshal(result.Data, &data)
+
+	if data.Cards.Total != 8 || data.Cards.HasMore || len(data.Cards.Cards) != 2 {
+		t.Errorf("Last page of creatures is wrong: %+v", data.Cards)
+	}
+
+	if len(data.Multiverse) != 2 {
+		t.Errorf("Both halves of a split card share a multiverse id: %+v", data.Multiverse)
+	}
+
+	if len(data.Set.Cards) != 1 || data.Set.Cards[0].Name != "Æther Vial" || data.Set.Cards[0].TypeLine != "Artifact" {
+		t.Errorf("Tempest should only have Æther Vial: %+v", data.Set)
+	}
+
+	if data.Missing != nil {
+		t.Errorf("Unknown ids should be null: %+v", data.Missing)
+	}
+
+	result = graphQuery(t, s, `{ cards(query: "cmc>three") { total } }`, nil)
+
+	if len(result.Errors) != 1 {
+		t.Errorf("Bad search queries should be an error: %+v", result)
+	}
+}
+
+func TestGraphQLGet(t *testing.T) {
+	s, _, cleanup := testServer(t)
+	defer cleanup()
+
+	r := httptest.NewRequest("GET", "/graphql?query="+url.QueryEscape("{ artists { name printingCount } }"), nil)
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, r)
+
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `{"name":"Amy Weber","printingCount":9}`) {
+		t.Errorf("GET should work too: %d %s", w.Code, w.Body)
+	}
+
+	r = httptest.NewRequest("POST", "/graphql", strings.NewReader("not json"))
+	w = httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, r)
+
+	if w.Code != 400 {
+		t.Errorf("A broken body should be 400, not %d", w.Code)
+	}
+}
+
+func TestGraphQLMaxDepth(t *testing.T) {
+	s, _, cleanup := testServer(t)
+	defer cleanup()
+
+	result := graphQuery(t, s, `{ sets { cards { printings { card { printings { card { printings { card { name } } } } } } } } }`, nil)
+
+	if len(result.Errors) == 0 || !strings.Contains(result.Errors[0].Message, "depth") {
+		t.Errorf("Queries nested past %d fields should be rejected: %+v", graphMaxDepth, result)
+	}
+
+	result = graphQuery(t, s, `{ sets { cards { printings { card { name } } } } }`, nil)
+
+	if len(result.Errors) != 0 {
+		t.Errorf("Shallower queries should still work: %+v", result.Errors)
+	}
+}
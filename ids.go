@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Card ids are the MD5 of the card's normalized name. Search results only
+// know a card's name, so this is the one scheme both can share, and it
+// doesn't change when Wizards errata a mana cost or a ligature.
+//
+// The rare face that shares a name with its partner gets a face number
+// appended before hashing, so the two halves never collide.
+
+// Ligatures and punctuation that Unicode decomposition leaves alone
+var nameReplacer = strings.NewReplacer("æ", "ae", "œ", "oe", "’", "'")
+
+// Lower case, fold ligatures and accents, and collapse whitespace. Accents
+// are dropped by decomposing each letter and removing the combining marks.
+func normalizeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Mn, r) {
+			return -1
+		}
+		return r
+	}, norm.NFKD.String(strings.ToLower(name)))
+	name = nameReplacer.Replace(name)
+	return strings.Join(strings.Fields(name), " ")
+}
+
+func OracleId(name string) string {
+	return hash(normalizeName(name))
+}
+
+// The id for the nth face of a card whose faces share a name
+func faceId(name string, face int) string {
+	if face == 0 {
+		return OracleId(name)
+	}
+	return hash(normalizeName(name) + "#" + strconv.Itoa(face))
+}
+
+// The id scheme used before oracle ids, MD5(Name + ManaCost)
+func legacyId(card Card) string {
+	return hash(card.Name + card.ManaCost)
+}
+
+// Rewrite every card id, and every partner card reference, to the current
+// scheme. Returns a map of old ids to new ones for ids that changed.
+//
+// Cards that end up with the same id, like a card whose mana cost was
+// errata'd between crawls, are merged into one.
+func (d *Deckbox) MigrateIds() map[string]string {
+	changes := map[string]string{}
+	byOld := map[string][]Card{}
+
+	for _, card := range d.Cards {
+		byOld[card.Id] = append(byOld[card.Id], card)
+	}
+
+	ids := make([]string, len(d.Cards))
+
+	for i, card := range d.Cards {
+		ids[i] = OracleId(card.Name)
+
+		for _, partner := range byOld[card.PartnerCard] {
+			if normalizeName(partner.Name) == normalizeName(card.Name) && secondFace(card, partner) {
+				ids[i] = faceId(card.Name, 1)
+				break
+			}
+		}
+
+		if ids[i] != card.Id {
+			changes[card.Id] = ids[i]
+		}
+	}
+
+	cards := d.Cards
+	d.Cards = []Card{}
+	d.idx = deckIndex{}
+	d.text = nil
+
+	for i, card := range cards {
+		card.Id = ids[i]
+
+		if newId, found := changes[card.PartnerCard]; found {
+			card.PartnerCard = newId
+		}
+
+		d.merge(card, false)
+	}
+
+	return changes
+}
+
+// Decide which of two faces sharing a name is the second one. Faces that
+// already have a current id keep it, so migrating twice changes nothing.
+func secondFace(card, partner Card) bool {
+	second := faceId(card.Name, 1)
+
+	if card.Id == second || partner.Id == second {
+		return card.Id == second
+	}
+
+	return legacyId(card) > legacyId(partner)
+}
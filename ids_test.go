@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNormalizeName(t *testing.T) {
+	tests := map[string]string{
+		"Æthersnipe":                 "aethersnipe",
+		"Aethersnipe":                "aethersnipe",
+		"  Huntmaster of  the Fells": "huntmaster of the fells",
+		"Dandân":                     "dandan",
+		"Ifh-Bíff Efreet":            "ifh-biff efreet",
+		"Señor Ñandú":                "senor nandu",
+		"Ǽther ﬁre":                  "aether fire",
+	}
+
+	for name, expected := range tests {
+		if n := normalizeName(name); n != expected {
+			t.Errorf("%q should normalize to %q, not %q", name, expected, n)
+		}
+	}
+}
+
+func TestOracleIdIgnoresErrata(t *testing.T) {
+	if OracleId("Æthersnipe") != OracleId("Aethersnipe") {
+		t.Errorf("Ligature errata shouldn't change a card's id")
+	}
+
+	if faceId("Who", 0) != OracleId("Who") {
+		t.Errorf("The first face should use the plain oracle id")
+	}
+
+	if faceId("Who", 1) == OracleId("Who") {
+		t.Errorf("The second face of a card should have its own id")
+	}
+}
+
+func TestMigrateIds(t *testing.T) {
+	front := Card{Name: "Huntmaster of the Fells", ManaCost: "{2}{R}{G}"}
+	back := Card{Name: "Ravager of the Fells"}
+	twinA := Card{Name: "Twin", ManaCost: "{1}"}
+	twinB := Card{Name: "Twin", ManaCost: "{2}"}
+	current := Card{Name: "Elspeth Tirel", Id: OracleId("Elspeth Tirel")}
+
+	front.Id = legacyId(front)
+	back.Id = legacyId(back)
+	front.PartnerCard = back.Id
+	back.PartnerCard = front.Id
+
+	twinA.Id = legacyId(twinA)
+	twinB.Id = legacyId(twinB)
+	twinA.PartnerCard = twinB.Id
+	twinB.PartnerCard = twinA.Id
+
+	box := Deckbox{Cards: []Card{front, back, twinA, twinB, current}}
+	changes := box.MigrateIds()
+
+	if len(changes) != 4 {
+		t.Errorf("Four ids should have changed, not %d", len(changes))
+	}
+
+	if changes[front.Id] != OracleId(front.Name) {
+		t.Errorf("Old id %s should map to %s, not %s", front.Id, OracleId(front.Name), changes[front.Id])
+	}
+
+	if box.Cards[0].PartnerCard != box.Cards[1].Id || box.Cards[1].PartnerCard != box.Cards[0].Id {
+		t.Errorf("Partner cards weren't migrated")
+	}
+
+	if box.Cards[2].Id == box.Cards[3].Id {
+		t.Errorf("Faces sharing a name shouldn't share an id")
+	}
+
+	if box.Cards[2].PartnerCard != box.Cards[3].Id || box.Cards[3].PartnerCard != box.Cards[2].Id {
+		t.Errorf("Partner cards sharing a name weren't migrated")
+	}
+
+	if again := box.MigrateIds(); len(again) != 0 {
+		t.Errorf("Migrating twice shouldn't change anything, changed %v", again)
+	}
+}
+
+func TestMigrateIdsMergesErrata(t *testing.T) {
+	before := Card{Name: "Ærathi Berserker", ManaCost: "{2}{R}{R}{R}", Editions: []Edition{Edition{MultiverseId: 1}}}
+	after := Card{Name: "Aerathi Berserker", ManaCost: "{2}{R}{R}{R}{R}", Editions: []Edition{Edition{MultiverseId: 2}}}
+	before.Id = legacyId(before)
+	after.Id = legacyId(after)
+
+	// A copy that already collided with before under the old scheme
+	again := before
+	again.Editions = []Edition{Edition{MultiverseId: 3}}
+
+	box := Deckbox{Cards: []Card{before, after, again}}
+	changes := box.MigrateIds()
+
+	if len(box.Cards) != 1 {
+		t.Fatalf("Cards sharing a name should be merged: %+v", box.Cards)
+	}
+
+	if changes[before.Id] != box.Cards[0].Id || changes[after.Id] != box.Cards[0].Id {
+		t.Errorf("Both old ids should map to the merged card: %v", changes)
+	}
+
+	if editions := box.Cards[0].Editions; len(editions) != 3 {
+		t.Errorf("The merged card should have every edition: %+v", editions)
+	}
+
+	if card, found := box.ById(OracleId(after.Name)); !found || card.Name == "" {
+		t.Errorf("The merged card should be indexed")
+	}
+}
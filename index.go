@@ -0,0 +1,180 @@
+package main
+
+import (
+	"sort"
+)
+
+// Deckbox keeps indexes from oracle id, normalized name and multiverse id to
+// positions in Cards. Every write keeps them up to date: Add and Swap update
+// them, and Sort, MigrateIds and loading rebuild them. Code that
+// changes Cards directly has to call reindex afterwards.
+//
+// Reads never touch the indexes, so a Deckbox can be shared between
+// goroutines once it's written. One that has never been indexed, like a
+// literal, is searched card by card.
+type deckIndex struct {
+	ids        map[string]int
+	names      map[string][]int
+	multiverse map[int][]int
+}
+
+func (d *Deckbox) reindex() {
+	d.idx = deckIndex{
+		ids:        map[string]int{},
+		names:      map[string][]int{},
+		multiverse: map[int][]int{},
+	}
+
+	for i := range d.Cards {
+		d.indexCard(i)
+	}
+}
+
+func (d *Deckbox) indexed() bool {
+	return d.idx.ids != nil
+}
+
+func (d *Deckbox) indexCard(i int) {
+	card := d.Cards[i]
+	name := normalizeName(card.Name)
+
+	if _, found := d.idx.ids[card.Id]; !found {
+		d.idx.ids[card.Id] = i
+	}
+
+	d.idx.names[name] = appendPosition(d.idx.names[name], i)
+
+	for _, e := range card.Editions {
+		d.idx.multiverse[e.MultiverseId] = appendPosition(d.idx.multiverse[e.MultiverseId], i)
+	}
+}
+
+func (d *Deckbox) unindexCard(i int) {
+	card := d.Cards[i]
+	name := normalizeName(card.Name)
+
+	if d.idx.ids[card.Id] == i {
+		delete(d.idx.ids, card.Id)
+	}
+
+	d.idx.names[name] = removePosition(d.idx.names[name], i)
+
+	for _, e := range card.Editions {
+		d.idx.multiverse[e.MultiverseId] = removePosition(d.idx.multiverse[e.MultiverseId], i)
+	}
+}
+
+// Move the cards at i and j, keeping the indexes up to date so a sort.Sort
+// outside of Sort doesn't lose them
+func (d *Deckbox) swapCards(i, j int) {
+	if !d.indexed() {
+		d.Cards[i], d.Cards[j] = d.Cards[j], d.Cards[i]
+		return
+	}
+
+	d.unindexCard(i)
+	d.unindexCard(j)
+	d.Cards[i], d.Cards[j] = d.Cards[j], d.Cards[i]
+	d.indexCard(i)
+	d.indexCard(j)
+}
+
+// Positions are kept in order, so lookups return cards in the order of Cards
+func appendPosition(positions []int, i int) []int {
+	k := sort.SearchInts(positions, i)
+
+	if k < len(positions) && positions[k] == i {
+		return positions
+	}
+
+	positions = append(positions, 0)
+	copy(positions[k+1:], positions[k:])
+	positions[k] = i
+	return positions
+}
+
+func removePosition(positions []int, i int) []int {
+	kept := positions[:0]
+
+	for _, p := range positions {
+		if p != i {
+			kept = append(kept, p)
+		}
+	}
+
+	return kept
+}
+
+// Find the position of the card with the given id
+func (d *Deckbox) position(id string) (int, bool) {
+	if d.indexed() {
+		i, found := d.idx.ids[id]
+		return i, found
+	}
+
+	for i, card := range d.Cards {
+		if card.Id == id {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+// Collect the cards at the given positions, or every card that matches if
+// the deckbox isn't indexed
+func (d *Deckbox) collect(positions []int, match func(Card) bool) []Card {
+	cards := []Card{}
+
+	if d.indexed() {
+		for _, i := range positions {
+			cards = append(cards, d.Cards[i])
+		}
+		return cards
+	}
+
+	for _, card := range d.Cards {
+		if match(card) {
+			cards = append(cards, card)
+		}
+	}
+
+	return cards
+}
+
+// The number of distinct card ids
+func (d *Deckbox) idCount() int {
+	if d.indexed() {
+		return len(d.idx.ids)
+	}
+	return len(d.IdSet())
+}
+
+func (d *Deckbox) ById(id string) (Card, bool) {
+	if i, found := d.position(id); found {
+		return d.Cards[i], true
+	}
+	return Card{}, false
+}
+
+// Find cards by name, ignoring case, accents and extra whitespace
+func (d *Deckbox) ByName(name string) []Card {
+	name = normalizeName(name)
+
+	return d.collect(d.idx.names[name], func(card Card) bool {
+		return normalizeName(card.Name) == name
+	})
+}
+
+// Find every card printed with the given multiverse id. Both halves of a
+// split card share one.
+func (d *Deckbox) ByMultiverseId(id int) []Card {
+	return d.collect(d.idx.multiverse[id], func(card Card) bool {
+		for _, e := range card.Editions {
+			if e.MultiverseId == id {
+				return true
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func TestDeckboxLookups(t *testing.T) {
+	box := Deckbox{}
+	box.Add(Card{Id: OracleId("Stand"), Name: "Stand", Editions: []Edition{Edition{MultiverseId: 20574}}})
+	box.Add(Card{Id: OracleId("Deliver"), Name: "Deliver", Editions: []Edition{Edition{MultiverseId: 20574}}})
+	box.Add(Card{Id: OracleId("Æthersnipe"), Name: "Æthersnipe", Editions: []Edition{Edition{MultiverseId: 189211}}})
+	box.Add(Card{Id: OracleId("Æthersnipe"), Name: "Æthersnipe", Editions: []Edition{Edition{MultiverseId: 145817}}})
+
+	if card, found := box.ById(OracleId("Stand")); !found || card.Name != "Stand" {
+		t.Errorf("Couldn't find Stand by id")
+	}
+
+	if _, found := box.ById("missing"); found {
+		t.Errorf("Found a card that isn't there")
+	}
+
+	if cards := box.ByName("aethersnipe"); len(cards) != 1 || len(cards[0].Editions) != 2 {
+		t.Errorf("Couldn't find Æthersnipe by name: %+v", cards)
+	}
+
+	if cards := box.ByMultiverseId(145817); len(cards) != 1 || cards[0].Name != "Æthersnipe" {
+		t.Errorf("Couldn't find Æthersnipe's new edition: %+v", cards)
+	}
+
+	if cards := box.ByMultiverseId(20574); len(cards) != 2 {
+		t.Errorf("Both halves of Stand // Deliver should share a multiverse id, found %d", len(cards))
+	}
+}
+
+func TestDeckboxReindex(t *testing.T) {
+	box := Deckbox{}
+	box.Add(Card{Id: "b", Name: "Bar", Editions: []Edition{Edition{MultiverseId: 2}}})
+	box.Add(Card{Id: "a", Name: "Foo", Editions: []Edition{Edition{MultiverseId: 1}}})
+
+	box.Sort()
+
+	if cards := box.ByName("Foo"); len(cards) != 1 || cards[0].Id != "a" {
+		t.Errorf("Lookup by name after sorting was wrong: %+v", cards)
+	}
+
+	box.Cards = append(box.Cards, Card{Id: "c", Name: "Baz", Editions: []Edition{Edition{MultiverseId: 3}}})
+	box.Cards[0].Name = "Qux"
+	box.reindex()
+
+	if cards := box.ByMultiverseId(3); len(cards) != 1 || cards[0].Id != "c" {
+		t.Errorf("Lookup after appending was wrong: %+v", cards)
+	}
+
+	if cards := box.ByName("Qux"); len(cards) != 1 || len(box.ByName(box.Cards[1].Name)) != 1 {
+		t.Errorf("Lookup after renaming in place was wrong: %+v", cards)
+	}
+
+	box.Add(Card{Id: "a", Name: "Foo", Editions: []Edition{Edition{MultiverseId: 4}}})
+
+	if len(box.Cards) != 3 {
+		t.Errorf("Adding a known card shouldn't grow the box, has %d cards", len(box.Cards))
+	}
+}
+
+func TestDeckboxSwap(t *testing.T) {
+	box := Deckbox{}
+	box.Add(Card{Id: "c", Name: "Baz", Editions: []Edition{Edition{MultiverseId: 1}}})
+	box.Add(Card{Id: "b", Name: "Bar", Editions: []Edition{Edition{MultiverseId: 1}}})
+	box.Add(Card{Id: "a", Name: "Foo", Editions: []Edition{Edition{MultiverseId: 2}}})
+
+	sort.Sort(&box)
+
+	if !box.indexed() {
+		t.Fatalf("Sorting shouldn't drop the index")
+	}
+
+	if card, found := box.ById("c"); !found || card.Name != "Baz" {
+		t.Errorf("Lookup by id after sorting was wrong: %+v", card)
+	}
+
+	if cards := box.ByMultiverseId(1); len(cards) != 2 || cards[0].Name != "Bar" || cards[1].Name != "Baz" {
+		t.Errorf("Lookups should return cards in sorted order: %+v", cards)
+	}
+
+	if ids := box.IdSet(); len(ids) != 3 || !ids["a"] {
+		t.Errorf("Expected all three ids, got %v", ids)
+	}
+
+	if set := box.MultiverseSet(); len(set) != 2 || !set[1] || !set[2] {
+		t.Errorf("Expected multiverse ids 1 and 2, got %v", set)
+	}
+}
+
+func TestDeckboxUnindexed(t *testing.T) {
+	box := Deckbox{Cards: []Card{
+		Card{Id: "a", Name: "Foo", Editions: []Edition{Edition{MultiverseId: 1}}},
+		Card{Id: "b", Name: "Bar", Editions: []Edition{Edition{MultiverseId: 1}}},
+	}}
+
+	if card, found := box.ById("b"); !found || card.Name != "Bar" {
+		t.Errorf("Couldn't find Bar by id")
+	}
+
+	if cards := box.ByMultiverseId(1); len(cards) != 2 {
+		t.Errorf("Both cards should share a multiverse id: %+v", cards)
+	}
+
+	if box.indexed() {
+		t.Errorf("Reads shouldn't build the index")
+	}
+}
+
+func benchmarkCards(n int) []Card {
+	cards := []Card{}
+
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("Card %d", i)
+		cards = append(cards, Card{
+			Id:       OracleId(name),
+			Name:     name,
+			Editions: []Edition{Edition{MultiverseId: i}, Edition{MultiverseId: n + i}},
+		})
+	}
+
+	return cards
+}
+
+func BenchmarkDeckboxAdd(b *testing.B) {
+	cards := benchmarkCards(14000)
+
+	for i := 0; i < b.N; i++ {
+		box := Deckbox{}
+
+		for _, card := range cards {
+			box.Add(card)
+		}
+	}
+}
+
+func BenchmarkDeckboxById(b *testing.B) {
+	box := Deckbox{Cards: benchmarkCards(14000)}
+	box.reindex()
+	id := OracleId("Card 7000")
+
+	for i := 0; i < b.N; i++ {
+		box.ById(id)
+	}
+}
+
+func BenchmarkDeckboxByName(b *testing.B) {
+	box := Deckbox{Cards: benchmarkCards(14000)}
+	box.reindex()
+
+	for i := 0; i < b.N; i++ {
+		box.ByName("card 7000")
+	}
+}
+
+func BenchmarkDeckboxByMultiverseId(b *testing.B) {
+	box := Deckbox{Cards: benchmarkCards(14000)}
+	box.reindex()
+
+	for i := 0; i < b.N; i++ {
+		box.ByMultiverseId(21000)
+	}
+}
@@ -0,0 +1,657 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Besides the legacy JSON array, the database can be stored as JSON Lines,
+// one card per line. A JSON Lines file is a log: flushing appends the cards
+// that changed, and loading merges every line with Deckbox.Refresh's rules,
+// so later lines refine earlier ones. Compacting rewrites the file with one line
+// per card.
+//
+// A crash while appending can leave the last line half written. Readers skip
+// it, and the next append cuts it off before writing.
+
+type CardWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func NewCardWriter(w io.Writer) *CardWriter {
+	buf := bufio.NewWriter(w)
+	return &CardWriter{w: buf, enc: json.NewEncoder(buf)}
+}
+
+func (cw *CardWriter) Write(card Card) error {
+	return cw.enc.Encode(card)
+}
+
+func (cw *CardWriter) Flush() error {
+	return cw.w.Flush()
+}
+
+// Read cards one at a time from either a JSON array or JSON Lines, without
+// loading the whole file into memory. The array can be bare or wrapped in an
+// envelope, and JSON Lines can start with a header line; see migrations.go.
+type CardReader struct {
+	dec    *json.Decoder
+	array  bool
+	header Header
+	// A card read while looking for a header
+	pending map[string]json.RawMessage
+	// The envelope's fields, while there are more to read after the cards
+	fields map[string]json.RawMessage
+	// Cards read before the envelope's schema version
+	raw []json.RawMessage
+	// The rest of a JSON Lines file, read a line at a time
+	lines *bufio.Reader
+}
+
+func NewCardReader(r io.Reader) (*CardReader, error) {
+	buf := bufio.NewReader(r)
+	first, err := peekByte(buf)
+
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	cr := &CardReader{dec: json.NewDecoder(buf)}
+
+	switch first {
+	case '[':
+		cr.array = true
+
+		// Consume the opening bracket
+		_, err := cr.dec.Token()
+
+		if err != nil {
+			return nil, err
+		}
+	case '{':
+		err := cr.readHeader()
+
+		if err != nil {
+			return nil, err
+		}
+	case 0:
+		// An empty file
+	default:
+		return nil, fmt.Errorf("expected a JSON array or JSON Lines, found %q", first)
+	}
+
+	if !cr.array {
+		cr.lines = bufio.NewReader(io.MultiReader(cr.dec.Buffered(), buf))
+	}
+
+	return cr, nil
+}
+
+// An object at the start of the stream is either an envelope, a JSON Lines
+// header, or the first card of a JSON Lines file without a header. Read
+// fields until the envelope's cards, or the end of the object. Flush writes
+// the header fields first so the cards can be streamed; if the schema version
+// comes after the cards instead, they're held until it's been read.
+func (cr *CardReader) readHeader() error {
+	// Consume the opening brace
+	_, err := cr.dec.Token()
+
+	if err != nil {
+		return err
+	}
+
+	fields := map[string]json.RawMessage{}
+
+	for cr.dec.More() {
+		token, err := cr.dec.Token()
+
+		if err != nil {
+			return err
+		}
+
+		key, _ := token.(string)
+
+		if key == "cards" {
+			token, err := cr.dec.Token()
+
+			if err != nil {
+				return err
+			}
+
+			if token != json.Delim('[') {
+				return fmt.Errorf("cards should be an array, found %v", token)
+			}
+
+			cr.array = true
+			cr.fields = fields
+
+			if _, found := fields["schema_version"]; found {
+				return fromFields(fields, &cr.header)
+			}
+
+			for cr.dec.More() {
+				var raw json.RawMessage
+				err := cr.dec.Decode(&raw)
+
+				if err != nil {
+					return err
+				}
+
+				cr.raw = append(cr.raw, raw)
+			}
+
+			return cr.finishEnvelope()
+		}
+
+		var value json.RawMessage
+		err = cr.dec.Decode(&value)
+
+		if err != nil {
+			return err
+		}
+
+		fields[key] = value
+	}
+
+	// Consume the closing brace
+	_, err = cr.dec.Token()
+
+	if err != nil {
+		return err
+	}
+
+	if _, found := fields["schema_version"]; found {
+		return fromFields(fields, &cr.header)
+	}
+
+	cr.pending = fields
+	return nil
+}
+
+// Read the envelope's fields after the end of its cards
+func (cr *CardReader) finishEnvelope() error {
+	fields := cr.fields
+	cr.fields = nil
+
+	// Consume the closing bracket
+	_, err := cr.dec.Token()
+
+	if err != nil {
+		return err
+	}
+
+	for cr.dec.More() {
+		token, err := cr.dec.Token()
+
+		if err != nil {
+			return err
+		}
+
+		key, _ := token.(string)
+
+		var value json.RawMessage
+		err = cr.dec.Decode(&value)
+
+		if err != nil {
+			return err
+		}
+
+		fields[key] = value
+	}
+
+	// Consume the closing brace
+	_, err = cr.dec.Token()
+
+	if err != nil {
+		return err
+	}
+
+	return fromFields(fields, &cr.header)
+}
+
+// Return the first byte that isn't whitespace, without consuming it
+func peekByte(buf *bufio.Reader) (byte, error) {
+	for {
+		b, err := buf.ReadByte()
+
+		if err != nil {
+			return 0, err
+		}
+
+		if !strings.ContainsRune(" \t\r\n", rune(b)) {
+			return b, buf.UnreadByte()
+		}
+	}
+}
+
+// Whether the cards are in a JSON array, bare or in an envelope, rather
+// than JSON Lines
+func (cr *CardReader) Array() bool {
+	return cr.array
+}
+
+// The header of the stream. Streams without one are version 0. Envelope
+// fields after the cards are only known once Next has returned io.EOF.
+func (cr *CardReader) Header() Header {
+	return cr.header
+}
+
+// Return the next card, or io.EOF when there are no more. Cards written by
+// older versions are migrated to the current one.
+func (cr *CardReader) Next() (Card, error) {
+	var card Card
+
+	if fields := cr.pending; fields != nil {
+		cr.pending = nil
+		return migrateCard(fields, cr.header.SchemaVersion)
+	}
+
+	if cr.lines != nil {
+		return cr.nextLine()
+	}
+
+	if cr.raw != nil {
+		return cr.nextRaw()
+	}
+
+	if !cr.dec.More() {
+		if cr.fields != nil {
+			err := cr.finishEnvelope()
+
+			if err != nil {
+				return card, err
+			}
+		}
+
+		return card, io.EOF
+	}
+
+	if needsCardMigration(cr.header.SchemaVersion) {
+		fields := map[string]json.RawMessage{}
+		err := cr.dec.Decode(&fields)
+
+		if err != nil {
+			return card, err
+		}
+
+		return migrateCard(fields, cr.header.SchemaVersion)
+	}
+
+	err := cr.dec.Decode(&card)
+	return card, err
+}
+
+// Return the next card held while reading the envelope
+func (cr *CardReader) nextRaw() (Card, error) {
+	var card Card
+
+	if len(cr.raw) == 0 {
+		return card, io.EOF
+	}
+
+	raw := cr.raw[0]
+	cr.raw = cr.raw[1:]
+
+	if !needsCardMigration(cr.header.SchemaVersion) {
+		err := json.Unmarshal(raw, &card)
+		return card, err
+	}
+
+	fields := map[string]json.RawMessage{}
+	err := json.Unmarshal(raw, &fields)
+
+	if err != nil {
+		return card, err
+	}
+
+	return migrateCard(fields, cr.header.SchemaVersion)
+}
+
+// Read the next card from a JSON Lines file, skipping a last line that a
+// crash cut short
+func (cr *CardReader) nextLine() (Card, error) {
+	for {
+		line, err := cr.lines.ReadBytes('\n')
+
+		if err != nil && err != io.EOF {
+			return Card{}, err
+		}
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			if err == io.EOF {
+				return Card{}, io.EOF
+			}
+			continue
+		}
+
+		if err == io.EOF && !json.Valid(line) {
+			log.Printf("WARNING: Skipping a partly written last line: %.40s...", line)
+			return Card{}, io.EOF
+		}
+
+		if !needsCardMigration(cr.header.SchemaVersion) {
+			var card Card
+			err = json.Unmarshal(line, &card)
+			return card, err
+		}
+
+		fields := map[string]json.RawMessage{}
+		err = json.Unmarshal(line, &fields)
+
+		if err != nil {
+			return Card{}, err
+		}
+
+		return migrateCard(fields, cr.header.SchemaVersion)
+	}
+}
+
+// Call fn with every card in the database at path, in order, until it
+// returns false. Files with one record per card at the current schema
+// version, which is anything Flush or compaction wrote, are streamed without
+// loading every card into memory. JSON Lines files with appended updates,
+// older files and SQLite databases are loaded and sorted first.
+func StreamCards(path string, fn func(Card) bool) error {
+	if !isSQLite(path) {
+		streamed, err := streamFile(path, fn)
+
+		if streamed || err != nil {
+			return err
+		}
+	}
+
+	box, err := openDeckbox(path)
+
+	if err != nil {
+		return err
+	}
+
+	box.Sort()
+
+	for _, card := range box.Cards {
+		if !fn(card) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Stream the cards in path if it can be, reporting whether it was
+func streamFile(path string, fn func(Card) bool) (bool, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return false, err
+	}
+
+	defer file.Close()
+
+	cr, err := NewCardReader(file)
+
+	if err != nil {
+		return false, err
+	}
+
+	if needsBoxMigration(cr.Header().SchemaVersion) {
+		return false, nil
+	}
+
+	if !cr.Array() {
+		lines, err := countCardLines(path)
+
+		if err != nil || lines != cr.Header().CardCount {
+			return false, err
+		}
+	}
+
+	for {
+		card, err := cr.Next()
+
+		if err == io.EOF {
+			return true, nil
+		}
+
+		if err != nil {
+			return true, err
+		}
+
+		if !fn(card) {
+			return true, nil
+		}
+	}
+}
+
+// The number of complete lines after the header of a JSON Lines file
+func countCardLines(path string) (int, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer file.Close()
+
+	lines := -1
+	chunk := make([]byte, 64*1024)
+
+	for {
+		n, err := file.Read(chunk)
+		lines += bytes.Count(chunk[:n], []byte{'\n'})
+
+		if err == io.EOF {
+			return lines, nil
+		}
+
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Whether path holds JSON Lines. Files that don't exist yet are JSON Lines
+// if their name ends in .jsonl.
+func isJSONLines(path string) bool {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return filepath.Ext(path) == ".jsonl"
+	}
+
+	defer file.Close()
+
+	cr, err := NewCardReader(file)
+
+	if err != nil {
+		return filepath.Ext(path) == ".jsonl"
+	}
+
+	return !cr.Array()
+}
+
+// Append cards to a JSON Lines file, starting new files with a header
+func AppendCards(path string, cards []Card) error {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	cw := NewCardWriter(file)
+	err = repairLastLine(file)
+
+	if err == nil {
+		var info os.FileInfo
+		info, err = file.Stat()
+
+		if err == nil && info.Size() == 0 {
+			err = cw.enc.Encode(Header{SchemaVersion: currentSchemaVersion()})
+		}
+	}
+
+	for _, card := range cards {
+		if err == nil {
+			err = cw.Write(card)
+		}
+	}
+
+	if err == nil {
+		err = cw.Flush()
+	}
+
+	if err == nil {
+		err = file.Sync()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// Make sure a JSON Lines file ends in a newline before appending to it. A
+// last line that isn't valid JSON was cut short by a crash and is removed; a
+// complete one just gets its newline.
+func repairLastLine(file *os.File) error {
+	info, err := file.Stat()
+
+	if err != nil {
+		return err
+	}
+
+	end := info.Size()
+	last := []byte{}
+	chunk := make([]byte, 4096)
+
+	for end > 0 {
+		start := end - int64(len(chunk))
+
+		if start < 0 {
+			start = 0
+		}
+
+		n, err := file.ReadAt(chunk[:end-start], start)
+
+		if err != nil {
+			return err
+		}
+
+		if i := bytes.LastIndexByte(chunk[:n], '\n'); i >= 0 {
+			last = append(append([]byte{}, chunk[i+1:n]...), last...)
+			end = start + int64(i) + 1
+			break
+		}
+
+		last = append(append([]byte{}, chunk[:n]...), last...)
+		end = start
+	}
+
+	switch {
+	case len(last) == 0:
+		return nil
+	case json.Valid(last):
+		_, err = file.Write([]byte{'\n'})
+		return err
+	}
+
+	log.Printf("WARNING: Removing a partly written last line from %s: %.40s...", file.Name(), last)
+	return file.Truncate(end)
+}
+
+// Rewrite path as JSON Lines with exactly one line per card. The cards are
+// sorted first.
+func (d *Deckbox) FlushLines(path string) error {
+	d.Sort()
+
+	var buf bytes.Buffer
+	cw := NewCardWriter(&buf)
+
+	err := cw.enc.Encode(d.header())
+
+	if err != nil {
+		return err
+	}
+
+	for _, card := range d.Cards {
+		err := cw.Write(card)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err = cw.Flush()
+
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(path, buf.Bytes(), flushOptions, verifyLines(len(d.Cards)))
+
+	if err == nil {
+		d.Header.SchemaVersion = currentSchemaVersion()
+	}
+
+	return err
+}
+
+// Check a compacted file has one parseable card per line
+func verifyLines(count int) func(string) error {
+	return func(path string) error {
+		file, err := os.Open(path)
+
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+
+		cr, err := NewCardReader(file)
+
+		if err != nil {
+			return err
+		}
+
+		read := 0
+
+		for {
+			_, err := cr.Next()
+
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				return err
+			}
+
+			read += 1
+		}
+
+		if read != count {
+			return fmt.Errorf("wrote %d cards, read back %d", count, read)
+		}
+
+		return nil
+	}
+}
+
+// Merge every line of a JSON Lines file and rewrite it with one line per card
+func CompactLines(path string) error {
+	box, err := loadDeckBox(path)
+
+	if err != nil {
+		return err
+	}
+
+	return box.FlushLines(path)
+}
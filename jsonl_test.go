@@ -0,0 +1,261 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readAll(t *testing.T, input string) []Card {
+	cr, err := NewCardReader(strings.NewReader(input))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cards := []Card{}
+
+	for {
+		card, err := cr.Next()
+
+		if err == io.EOF {
+			return cards
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cards = append(cards, card)
+	}
+}
+
+func TestCardReader(t *testing.T) {
+	array := readAll(t, "  [{\"id\": \"A\"}, {\"id\": \"B\"}]\n")
+	lines := readAll(t, "{\"id\": \"A\"}\n{\"id\": \"B\"}\n")
+
+	for _, cards := range [][]Card{array, lines} {
+		if len(cards) != 2 || cards[0].Id != "A" || cards[1].Id != "B" {
+			t.Errorf("Expected cards A and B, got %+v", cards)
+		}
+	}
+
+	if cards := readAll(t, ""); len(cards) != 0 {
+		t.Errorf("An empty file should have no cards, not %d", len(cards))
+	}
+}
+
+func TestJSONLinesAppendAndCompact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frantic")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cards.jsonl")
+
+	if !isJSONLines(path) {
+		t.Errorf("A new .jsonl file should be JSON Lines")
+	}
+
+	err = AppendCards(path, []Card{
+		Card{Id: "A", Name: "Foo", Editions: []Edition{Edition{MultiverseId: 1}}},
+		Card{Id: "B", Name: "Bar", Editions: []Edition{Edition{MultiverseId: 2}}},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = AppendCards(path, []Card{
+		Card{Id: "A", Name: "Foo", Editions: []Edition{Edition{MultiverseId: 1, Set: "Alpha"}, Edition{MultiverseId: 3}}},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	box, err := loadDeckBox(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(box.Cards) != 2 {
+		t.Fatalf("Appended lines should merge into 2 cards, not %d", len(box.Cards))
+	}
+
+	card, _ := box.ById("A")
+
+	if len(card.Editions) != 2 || card.Editions[0].Set != "Alpha" {
+		t.Errorf("Appended editions weren't merged: %+v", card.Editions)
+	}
+
+	err = CompactLines(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blob, _ := ioutil.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(blob)), "\n")
+
+	if len(lines) != 3 || !strings.Contains(lines[0], `"schema_version":1`) || !strings.Contains(lines[1], `"name":"Bar"`) {
+		t.Errorf("Compacted file should have a header and one sorted line per card:\n%s", blob)
+	}
+
+	if !isJSONLines(path) {
+		t.Errorf("A compacted file should still be JSON Lines")
+	}
+}
+
+func TestLoadLegacyArray(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frantic")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cards.json")
+	box := Deckbox{Cards: []Card{Card{Id: "A"}, Card{Id: "B"}}}
+	err = box.Flush(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if isJSONLines(path) {
+		t.Errorf("A JSON array shouldn't be detected as JSON Lines")
+	}
+
+	loaded, err := loadDeckBox(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(loaded.Cards) != 2 {
+		t.Errorf("Expected 2 cards, not %d", len(loaded.Cards))
+	}
+}
+
+func TestJSONLinesTornLastLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frantic")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cards.jsonl")
+	err = AppendCards(path, []Card{Card{Id: "A", Name: "Foo"}, Card{Id: "B", Name: "Bar"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash halfway through the next append
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	file.WriteString(`{"id": "C", "name": "Ba`)
+	file.Close()
+
+	box, err := loadDeckBox(path)
+
+	if err != nil {
+		t.Fatalf("A torn last line should be skipped: %s", err)
+	}
+
+	if len(box.Cards) != 2 {
+		t.Errorf("Only the complete lines should load: %+v", box.Cards)
+	}
+
+	err = AppendCards(path, []Card{Card{Id: "D", Name: "Qux"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blob, _ := ioutil.ReadFile(path)
+	box, err = loadDeckBox(path)
+
+	if err != nil || len(box.Cards) != 3 || strings.Contains(string(blob), `"C"`) {
+		t.Errorf("The next append should replace the torn line:\n%s", blob)
+	}
+
+	// A complete card without its newline is kept
+	file, _ = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	file.WriteString(`{"id": "E", "name": "Baz"}`)
+	file.Close()
+
+	err = AppendCards(path, []Card{Card{Id: "F", Name: "Quux"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	box, err = loadDeckBox(path)
+
+	if err != nil || len(box.Cards) != 5 {
+		t.Errorf("Expected cards A, B, D, E and F, got %+v %v", box.Cards, err)
+	}
+}
+
+func TestStreamCards(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frantic")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cards.jsonl")
+	box := Deckbox{}
+	box.Add(Card{Id: "A", Name: "Foo", Editions: []Edition{Edition{MultiverseId: 1}}})
+	box.Add(Card{Id: "B", Name: "Bar", Editions: []Edition{Edition{MultiverseId: 2}}})
+	box.Add(Card{Id: "C", Name: "Baz", Editions: []Edition{Edition{MultiverseId: 3}}})
+
+	err = box.FlushLines(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	streamed, err := streamFile(path, func(card Card) bool {
+		names = append(names, card.Name)
+		return len(names) < 2
+	})
+
+	if err != nil || !streamed {
+		t.Errorf("A compacted file should be streamed: %v", err)
+	}
+
+	if strings.Join(names, ",") != "Bar,Baz" {
+		t.Errorf("Streaming should be in order and stop early: %v", names)
+	}
+
+	AppendCards(path, []Card{Card{Id: "A", Name: "Foo", Editions: []Edition{Edition{MultiverseId: 4}}}})
+
+	if streamed, _ := streamFile(path, func(Card) bool { return true }); streamed {
+		t.Errorf("A file with appended updates can't be streamed")
+	}
+
+	cards := []Card{}
+	err = StreamCards(path, func(card Card) bool {
+		cards = append(cards, card)
+		return true
+	})
+
+	if err != nil || len(cards) != 3 || len(cards[2].Editions) != 2 {
+		t.Errorf("Appended updates should be merged before streaming: %+v %v", cards, err)
+	}
+}
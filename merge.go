@@ -0,0 +1,132 @@
+package main
+
+import (
+	"sort"
+)
+
+// When the same card or edition is added more than once, the two copies are
+// merged field by field. A value that's set beats one that's empty, and when
+// both are set the greater value wins. Editions are matched by multiverse id
+// and kept sorted by it.
+//
+// Every rule is commutative and associative, so adding the same cards in any
+// order builds the same Deckbox.
+//
+// A fresh copy, like a card that was just crawled, is different: its set
+// values win over the stored ones, so a re-crawl picks up errata. Values it
+// leaves empty are kept.
+
+// Merge card b into card a. If b is fresh, its set values win.
+func mergeCards(a, b Card, fresh bool) Card {
+	return Card{
+		Name:           mergeString(a.Name, b.Name, fresh),
+		Id:             mergeString(a.Id, b.Id, fresh),
+		Types:          mergeStrings(a.Types, b.Types, fresh),
+		Subtypes:       mergeStrings(a.Subtypes, b.Subtypes, fresh),
+		ConvertedCost:  mergeFloat(a.ConvertedCost, b.ConvertedCost, fresh),
+		ManaCost:       mergeString(a.ManaCost, b.ManaCost, fresh),
+		Special:        mergeString(a.Special, b.Special, fresh),
+		PartnerCard:    mergeString(a.PartnerCard, b.PartnerCard, fresh),
+		Side:           mergeString(a.Side, b.Side, fresh),
+		RulesText:      mergeStrings(a.RulesText, b.RulesText, fresh),
+		ColorIndicator: mergeStrings(a.ColorIndicator, b.ColorIndicator, fresh),
+		Power:          mergeString(a.Power, b.Power, fresh),
+		Toughness:      mergeString(a.Toughness, b.Toughness, fresh),
+		Loyalty:        mergeInt(a.Loyalty, b.Loyalty, fresh),
+		Editions:       mergeEditionLists(a.Editions, b.Editions, fresh),
+	}
+}
+
+func mergeEditions(a, b Edition, fresh bool) Edition {
+	return Edition{
+		Set:          mergeString(a.Set, b.Set, fresh),
+		Watermark:    mergeString(a.Watermark, b.Watermark, fresh),
+		Rarity:       mergeString(a.Rarity, b.Rarity, fresh),
+		Artist:       mergeString(a.Artist, b.Artist, fresh),
+		MultiverseId: mergeInt(a.MultiverseId, b.MultiverseId, fresh),
+		FlavorText:   mergeStrings(a.FlavorText, b.FlavorText, fresh),
+		Number:       mergeString(a.Number, b.Number, fresh),
+	}
+}
+
+func mergeEditionLists(a, b []Edition, fresh bool) []Edition {
+	if len(a) == 0 && len(b) == 0 {
+		if a == nil {
+			return b
+		}
+		return a
+	}
+
+	byId := map[int]Edition{}
+
+	for _, editions := range [][]Edition{a, b} {
+		for _, e := range editions {
+			if old, found := byId[e.MultiverseId]; found {
+				byId[e.MultiverseId] = mergeEditions(old, e, fresh)
+			} else {
+				byId[e.MultiverseId] = e
+			}
+		}
+	}
+
+	merged := []Edition{}
+
+	for _, e := range byId {
+		merged = append(merged, e)
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].MultiverseId < merged[j].MultiverseId
+	})
+
+	return merged
+}
+
+func mergeString(a, b string, fresh bool) string {
+	if b == "" || (!fresh && a > b) {
+		return a
+	}
+	return b
+}
+
+func mergeInt(a, b int, fresh bool) int {
+	if b == 0 || (!fresh && a > b) {
+		return a
+	}
+	return b
+}
+
+func mergeFloat(a, b float64, fresh bool) float64 {
+	if b == 0 || (!fresh && a > b) {
+		return a
+	}
+	return b
+}
+
+// Empty lists lose to anything, but an empty list still beats a nil one so
+// that the JSON output doesn't depend on order.
+func mergeStrings(a, b []string, fresh bool) []string {
+	if len(a) == 0 && len(b) == 0 {
+		if a == nil {
+			return b
+		}
+		return a
+	}
+
+	if len(b) == 0 || (!fresh && compareStrings(a, b) > 0) {
+		return a
+	}
+	return b
+}
+
+func compareStrings(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] < b[i] {
+			return -1
+		}
+		if a[i] > b[i] {
+			return 1
+		}
+	}
+	return len(a) - len(b)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+)
+
+type cardList []Card
+
+func pick(r *rand.Rand, values ...string) string {
+	return values[r.Intn(len(values))]
+}
+
+func pickStrings(r *rand.Rand) []string {
+	switch r.Intn(4) {
+	case 0:
+		return nil
+	case 1:
+		return []string{}
+	case 2:
+		return []string{pick(r, "Flying", "Trample")}
+	}
+	return []string{pick(r, "Flying", "Trample"), pick(r, "Haste", "Vigilance")}
+}
+
+func randomEdition(r *rand.Rand) Edition {
+	return Edition{
+		MultiverseId: 1 + r.Intn(5),
+		Set:          pick(r, "", "Alpha", "Beta"),
+		Rarity:       pick(r, "", "common", "rare"),
+		Artist:       pick(r, "", "Rebecca Guay"),
+		Number:       pick(r, "", "1", "140a"),
+		FlavorText:   pickStrings(r),
+	}
+}
+
+func (cardList) Generate(r *rand.Rand, size int) reflect.Value {
+	cards := cardList{}
+
+	for i := 0; i < 1+r.Intn(size+1); i++ {
+		card := Card{
+			Id:            pick(r, "a", "b", "c"),
+			Name:          pick(r, "", "Foo", "Bar"),
+			ManaCost:      pick(r, "", "{G}", "{1}{G}"),
+			ConvertedCost: float64(r.Intn(3)),
+			Types:         pickStrings(r),
+			RulesText:     pickStrings(r),
+			Power:         pick(r, "", "1", "*"),
+			Loyalty:       r.Intn(2),
+		}
+
+		for j := 0; j < 1+r.Intn(3); j++ {
+			card.Editions = append(card.Editions, randomEdition(r))
+		}
+
+		cards = append(cards, card)
+	}
+
+	return reflect.ValueOf(cards)
+}
+
+func buildBox(cards []Card) Deckbox {
+	box := Deckbox{}
+
+	for _, card := range cards {
+		box.Add(card)
+	}
+
+	box.Sort()
+	return box
+}
+
+// The generated cards share ids and conflict on names, costs, rules text and
+// every edition field, so this covers set values beating each other as well
+// as beating empty ones
+func TestAddOrderIndependent(t *testing.T) {
+	f := func(cards cardList, seed int64) bool {
+		shuffled := make([]Card, len(cards))
+		copy(shuffled, cards)
+
+		r := rand.New(rand.NewSource(seed))
+		r.Shuffle(len(shuffled), func(i, j int) {
+			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		})
+
+		return reflect.DeepEqual(buildBox(cards), buildBox(shuffled))
+	}
+
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAddIdempotent(t *testing.T) {
+	f := func(cards cardList) bool {
+		twice := append(append([]Card{}, cards...), cards...)
+		return reflect.DeepEqual(buildBox(cards), buildBox(twice))
+	}
+
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMergeEditionLists(t *testing.T) {
+	old := []Edition{Edition{MultiverseId: 3, Set: "Foo"}, Edition{MultiverseId: 1}}
+	newer := []Edition{Edition{MultiverseId: 2, Set: "Bar"}, Edition{MultiverseId: 1, Set: "Baz", Artist: "Quinton Hoover"}}
+
+	merged := mergeEditionLists(old, newer, false)
+	expected := []Edition{
+		Edition{MultiverseId: 1, Set: "Baz", Artist: "Quinton Hoover"},
+		Edition{MultiverseId: 2, Set: "Bar"},
+		Edition{MultiverseId: 3, Set: "Foo"},
+	}
+
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("Merged editions were wrong: got\n%+v\ninstead of\n%+v", merged, expected)
+	}
+}
+
+func TestMergeFields(t *testing.T) {
+	a := Card{Id: "f", Name: "Foo", RulesText: []string{}, Power: "2"}
+	b := Card{Id: "f", ManaCost: "{G}", RulesText: []string{"Trample"}, Toughness: "3"}
+
+	merged := mergeCards(a, b, false)
+
+	if merged.Name != "Foo" || merged.ManaCost != "{G}" || merged.Power != "2" || merged.Toughness != "3" {
+		t.Errorf("Set fields should win over empty ones: %+v", merged)
+	}
+
+	if !reflect.DeepEqual(merged.RulesText, []string{"Trample"}) {
+		t.Errorf("Rules text should be [Trample], not %v", merged.RulesText)
+	}
+
+}
+
+func TestMergeErrata(t *testing.T) {
+	stored := Card{Id: "f", Name: "Foo", ManaCost: "{G}{G}", ConvertedCost: 2, RulesText: []string{"Trample"}, Power: "2"}
+	crawled := Card{Id: "f", Name: "Foo", ManaCost: "{1}{G}", ConvertedCost: 1.5, RulesText: []string{"Haste"}}
+
+	merged := mergeCards(stored, crawled, true)
+
+	if merged.ManaCost != "{1}{G}" || merged.ConvertedCost != 1.5 || !reflect.DeepEqual(merged.RulesText, []string{"Haste"}) {
+		t.Errorf("Freshly crawled values should win even when they sort lower: %+v", merged)
+	}
+
+	if merged.Power != "2" {
+		t.Errorf("Fields the crawl left empty should be kept: %+v", merged)
+	}
+
+	// Either way round, plain merging keeps the greater values
+	for _, merged := range []Card{mergeCards(stored, crawled, false), mergeCards(crawled, stored, false)} {
+		if merged.ManaCost != "{G}{G}" || merged.ConvertedCost != 2 || !reflect.DeepEqual(merged.RulesText, []string{"Trample"}) {
+			t.Errorf("Merging without a fresh copy should keep the greater values: %+v", merged)
+		}
+	}
+}
@@ -0,0 +1,528 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// Combining databases from partial crawls. Each field is compared against an
+// optional base database: a value changed in just one source is taken as is,
+// and sources that changed it to different values conflict. Conflicts are
+// settled by a MergePolicy and always reported.
+//
+// Empty values carry no information, since partial crawls are full of stub
+// editions, so they never replace a value that's set.
+
+type MergePolicy string
+
+const (
+	// The value from the most recently crawled source wins
+	PolicyNewest MergePolicy = "newest"
+	// Set values fill in empty ones, and two different set values are left
+	// for someone to resolve by hand, as with PolicyManual
+	PolicyNonEmpty MergePolicy = "nonempty"
+	// Keep the base value, or the first source's, and leave the conflict
+	// for someone to resolve by hand
+	PolicyManual MergePolicy = "manual"
+)
+
+type MergeSource struct {
+	Name string
+	Box  *Deckbox
+	// When the source was crawled, used by PolicyNewest
+	Time time.Time
+}
+
+type Conflict struct {
+	Id       string          `json:"id"`
+	Name     string          `json:"name"`
+	Field    string          `json:"field"`
+	Values   []ConflictValue `json:"values"`
+	Chosen   json.RawMessage `json:"chosen"`
+	Resolved bool            `json:"resolved"`
+}
+
+type ConflictValue struct {
+	Source string          `json:"source"`
+	Value  json.RawMessage `json:"value"`
+}
+
+// A field value from one source
+type candidate struct {
+	source int
+	value  json.RawMessage
+}
+
+type merger struct {
+	policy    MergePolicy
+	sources   []MergeSource
+	conflicts []Conflict
+}
+
+func MergeDeckboxes(base *Deckbox, sources []MergeSource, policy MergePolicy) (Deckbox, []Conflict, error) {
+	switch policy {
+	case PolicyNewest, PolicyNonEmpty, PolicyManual:
+	default:
+		return Deckbox{}, nil, fmt.Errorf("unknown merge policy %s", policy)
+	}
+
+	m := &merger{policy: policy, sources: sources, conflicts: []Conflict{}}
+
+	if base == nil {
+		base = &Deckbox{}
+	}
+
+	ids := []string{}
+	seen := map[string]bool{}
+
+	for _, box := range append([]*Deckbox{base}, boxes(sources)...) {
+		for _, card := range box.Cards {
+			if !seen[card.Id] {
+				seen[card.Id] = true
+				ids = append(ids, card.Id)
+			}
+		}
+	}
+
+	sort.Strings(ids)
+
+	merged := Deckbox{Cards: []Card{}}
+
+	for _, id := range ids {
+		card, err := m.mergeCard(base, id)
+
+		if err != nil {
+			return merged, m.conflicts, err
+		}
+
+		merged.Cards = append(merged.Cards, card)
+	}
+
+	merged.Sort()
+	return merged, m.conflicts, nil
+}
+
+func boxes(sources []MergeSource) []*Deckbox {
+	result := []*Deckbox{}
+
+	for _, s := range sources {
+		result = append(result, s.Box)
+	}
+
+	return result
+}
+
+func toFields(v interface{}) (map[string]json.RawMessage, error) {
+	blob, err := json.Marshal(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]json.RawMessage{}
+	err = json.Unmarshal(blob, &fields)
+	return fields, err
+}
+
+func fromFields(fields map[string]json.RawMessage, v interface{}) error {
+	blob, err := json.Marshal(fields)
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(blob, v)
+}
+
+func emptyValue(value json.RawMessage) bool {
+	switch string(value) {
+	case "", `""`, "0", "[]", "{}", "null":
+		return true
+	}
+	return false
+}
+
+func (m *merger) mergeCard(base *Deckbox, id string) (Card, error) {
+	baseCard, inBase := base.ById(id)
+	var baseFields map[string]json.RawMessage
+	var err error
+
+	if inBase {
+		baseFields, err = toFields(baseCard)
+
+		if err != nil {
+			return Card{}, err
+		}
+	}
+
+	versions := map[int]map[string]json.RawMessage{}
+	editions := map[int][]Edition{}
+	name := baseCard.Name
+
+	for i, source := range m.sources {
+		card, found := source.Box.ById(id)
+
+		if !found {
+			continue
+		}
+
+		if name == "" {
+			name = card.Name
+		}
+
+		versions[i], err = toFields(card)
+
+		if err != nil {
+			return Card{}, err
+		}
+
+		editions[i] = card.Editions
+	}
+
+	// Editions are merged one by one below
+	delete(baseFields, "editions")
+
+	for _, fields := range versions {
+		delete(fields, "editions")
+	}
+
+	fields := m.mergeFields(baseFields, versions, id, name, "")
+
+	var card Card
+	err = fromFields(fields, &card)
+
+	if err != nil {
+		return card, err
+	}
+
+	card.Editions, err = m.mergeEditions(baseCard.Editions, editions, id, name)
+	return card, err
+}
+
+func (m *merger) mergeEditions(base []Edition, versions map[int][]Edition, id, name string) ([]Edition, error) {
+	baseById := map[int]Edition{}
+	all := map[int]bool{}
+
+	for _, e := range base {
+		baseById[e.MultiverseId] = e
+		all[e.MultiverseId] = true
+	}
+
+	for _, editions := range versions {
+		for _, e := range editions {
+			all[e.MultiverseId] = true
+		}
+	}
+
+	mids := []int{}
+
+	for mid := range all {
+		mids = append(mids, mid)
+	}
+
+	sort.Ints(mids)
+
+	merged := []Edition{}
+
+	for _, mid := range mids {
+		var baseFields map[string]json.RawMessage
+		var err error
+
+		if e, found := baseById[mid]; found {
+			baseFields, err = toFields(e)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		edition := map[int]map[string]json.RawMessage{}
+
+		for i, editions := range versions {
+			for _, e := range editions {
+				if e.MultiverseId == mid {
+					edition[i], err = toFields(e)
+
+					if err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+
+		fields := m.mergeFields(baseFields, edition, id, name, fmt.Sprintf("editions[%d].", mid))
+
+		var e Edition
+		err = fromFields(fields, &e)
+
+		if err != nil {
+			return nil, err
+		}
+
+		merged = append(merged, e)
+	}
+
+	return merged, nil
+}
+
+// Merge every field present in the base or any version. Conflicts are
+// reported with the field name after prefix.
+func (m *merger) mergeFields(base map[string]json.RawMessage, versions map[int]map[string]json.RawMessage, id, name, prefix string) map[string]json.RawMessage {
+	seen := map[string]bool{}
+	keys := []string{}
+
+	for _, fields := range append([]map[string]json.RawMessage{base}, values(versions)...) {
+		for key := range fields {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	sort.Strings(keys)
+
+	order := []int{}
+
+	for i := range versions {
+		order = append(order, i)
+	}
+
+	sort.Ints(order)
+
+	merged := map[string]json.RawMessage{}
+
+	for _, key := range keys {
+		candidates := []candidate{}
+
+		for _, i := range order {
+			if value, found := versions[i][key]; found {
+				candidates = append(candidates, candidate{source: i, value: value})
+			}
+		}
+
+		merged[key] = m.mergeField(base[key], candidates, id, name, prefix+key)
+	}
+
+	return merged
+}
+
+func values(versions map[int]map[string]json.RawMessage) []map[string]json.RawMessage {
+	result := []map[string]json.RawMessage{}
+
+	for _, fields := range versions {
+		result = append(result, fields)
+	}
+
+	return result
+}
+
+func (m *merger) mergeField(base json.RawMessage, candidates []candidate, id, name, field string) json.RawMessage {
+	// Only values that are set and differ from the base count as changes
+	changes := []candidate{}
+
+	for _, c := range candidates {
+		if emptyValue(c.value) || bytes.Equal(c.value, base) {
+			continue
+		}
+		changes = append(changes, c)
+	}
+
+	if len(changes) == 0 {
+		if base != nil {
+			return base
+		}
+		if len(candidates) > 0 {
+			return candidates[0].value
+		}
+		return nil
+	}
+
+	distinct := changes[:1]
+
+	for _, c := range changes[1:] {
+		if !bytes.Equal(c.value, distinct[0].value) {
+			distinct = changes
+			break
+		}
+	}
+
+	if len(distinct) == 1 {
+		return distinct[0].value
+	}
+
+	chosen, resolved := m.resolve(base, changes)
+
+	conflict := Conflict{Id: id, Name: name, Field: field, Chosen: chosen, Resolved: resolved}
+
+	if base != nil {
+		conflict.Values = append(conflict.Values, ConflictValue{Source: "base", Value: base})
+	}
+
+	for _, c := range changes {
+		conflict.Values = append(conflict.Values, ConflictValue{Source: m.sources[c.source].Name, Value: c.value})
+	}
+
+	m.conflicts = append(m.conflicts, conflict)
+	return chosen
+}
+
+func (m *merger) resolve(base json.RawMessage, changes []candidate) (json.RawMessage, bool) {
+	switch m.policy {
+	case PolicyNewest:
+		newest := changes[0]
+
+		for _, c := range changes[1:] {
+			if m.sources[c.source].Time.After(m.sources[newest.source].Time) {
+				newest = c
+			}
+		}
+
+		return newest.value, true
+	}
+
+	if base != nil && !emptyValue(base) {
+		return base, false
+	}
+
+	return changes[0].value, false
+}
+
+func unresolved(conflicts []Conflict) int {
+	count := 0
+
+	for _, c := range conflicts {
+		if !c.Resolved {
+			count += 1
+		}
+	}
+
+	return count
+}
+
+func writeConflicts(w io.Writer, conflicts []Conflict) {
+	fmt.Fprintf(w, "%d conflicts, %d unresolved\n", len(conflicts), unresolved(conflicts))
+
+	for _, c := range conflicts {
+		status := "resolved"
+
+		if !c.Resolved {
+			status = "UNRESOLVED"
+		}
+
+		fmt.Fprintf(w, "%s (%s) %s: %s, chose %s\n", c.Name, c.Id, c.Field, status, c.Chosen)
+
+		for _, v := range c.Values {
+			fmt.Fprintf(w, "    %s: %s\n", v.Source, v.Value)
+		}
+	}
+}
+
+// frantic merge [-base master.json] [-policy newest] [-report conflicts.json] -o out.json a.json b.json ...
+func mergeCommand(args []string) error {
+	flags := flag.NewFlagSet("merge", flag.ExitOnError)
+	basePath := flags.String("base", "", "The database the sources were crawled from")
+	policy := flags.String("policy", string(PolicyNewest), "How to settle conflicts: newest, nonempty or manual")
+	output := flags.String("o", "", "Where to write the merged database")
+	report := flags.String("report", "", "Write the conflict report as JSON to this file")
+	flags.Parse(args)
+
+	if *output == "" || flags.NArg() == 0 {
+		return fmt.Errorf("usage: merge [-base master.json] [-policy newest|nonempty|manual] -o out.json a.json b.json ...")
+	}
+
+	var base *Deckbox
+
+	if *basePath != "" {
+		box, err := openDeckbox(*basePath)
+
+		if err != nil {
+			return err
+		}
+
+		base = &box
+	}
+
+	sources := []MergeSource{}
+	var latest time.Time
+
+	for _, path := range flags.Args() {
+		box, err := openDeckbox(path)
+
+		if err != nil {
+			return err
+		}
+
+		crawled, err := crawlTime(path, &box)
+
+		if err != nil && MergePolicy(*policy) == PolicyNewest {
+			return err
+		}
+
+		if crawled.After(latest) {
+			latest = crawled
+		}
+
+		sources = append(sources, MergeSource{Name: path, Box: &box, Time: crawled})
+	}
+
+	merged, conflicts, err := MergeDeckboxes(base, sources, MergePolicy(*policy))
+
+	if err != nil {
+		return err
+	}
+
+	if !latest.IsZero() {
+		merged.Header.GeneratedAt = latest.UTC().Format(time.RFC3339)
+	}
+
+	writeConflicts(os.Stdout, conflicts)
+
+	if *report != "" {
+		blob, err := json.MarshalIndent(conflicts, "", "  ")
+
+		if err != nil {
+			return err
+		}
+
+		err = writeFileAtomic(*report, append(blob, '\n'), FlushOptions{}, nil)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if n := unresolved(conflicts); n > 0 {
+		return fmt.Errorf("%d conflicts need to be resolved by hand, %s wasn't written", n, *output)
+	}
+
+	return exportDeckbox(&merged, *output)
+}
+
+// When a source was crawled, from its header. Files from before headers
+// existed fall back to when they were last modified.
+func crawlTime(path string, box *Deckbox) (time.Time, error) {
+	if box.Header.SchemaVersion > 0 {
+		t, err := time.Parse(time.RFC3339, box.Header.GeneratedAt)
+
+		if err != nil {
+			return t, fmt.Errorf("%s: no crawl time in the header: %s", path, err)
+		}
+
+		return t, nil
+	}
+
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return info.ModTime(), nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func mergeFixture() (*Deckbox, []MergeSource) {
+	base := &Deckbox{Cards: []Card{
+		Card{Id: "a", Name: "Alpha", ManaCost: "{G}", RulesText: []string{"Trample"},
+			Editions: []Edition{Edition{MultiverseId: 1, Set: "Alpha", Artist: "Quinton Hoover"}}},
+	}}
+
+	older := &Deckbox{Cards: []Card{
+		Card{Id: "a", Name: "Alpha", ManaCost: "{1}{G}", RulesText: []string{"Trample"},
+			Editions: []Edition{Edition{MultiverseId: 1}, Edition{MultiverseId: 2, Set: "Beta"}}},
+	}}
+
+	newer := &Deckbox{Cards: []Card{
+		Card{Id: "a", Name: "Alpha", ManaCost: "{2}{G}", RulesText: []string{"Flying"},
+			Editions: []Edition{Edition{MultiverseId: 1, Set: "Alpha", Artist: "Quinton Hoover"}}},
+		Card{Id: "b", Name: "Beta", Editions: []Edition{Edition{MultiverseId: 3}}},
+	}}
+
+	now := time.Now()
+
+	return base, []MergeSource{
+		MergeSource{Name: "older.json", Box: older, Time: now.Add(-time.Hour)},
+		MergeSource{Name: "newer.json", Box: newer, Time: now},
+	}
+}
+
+func TestMergeNewest(t *testing.T) {
+	base, sources := mergeFixture()
+	merged, conflicts, err := MergeDeckboxes(base, sources, PolicyNewest)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(merged.Cards) != 2 {
+		t.Fatalf("Merged database should have 2 cards, not %d", len(merged.Cards))
+	}
+
+	alpha, _ := merged.ById("a")
+
+	if alpha.ManaCost != "{2}{G}" {
+		t.Errorf("The newest mana cost should win, got %s", alpha.ManaCost)
+	}
+
+	if !reflect.DeepEqual(alpha.RulesText, []string{"Flying"}) {
+		t.Errorf("A change in one source should be taken, got %v", alpha.RulesText)
+	}
+
+	expected := []Edition{
+		Edition{MultiverseId: 1, Set: "Alpha", Artist: "Quinton Hoover"},
+		Edition{MultiverseId: 2, Set: "Beta"},
+	}
+
+	if !reflect.DeepEqual(alpha.Editions, expected) {
+		t.Errorf("Stub editions shouldn't erase fields: got %+v", alpha.Editions)
+	}
+
+	if len(conflicts) != 1 || conflicts[0].Field != "mana_cost" || !conflicts[0].Resolved {
+		t.Fatalf("Expected one resolved mana_cost conflict, got %+v", conflicts)
+	}
+
+	if len(conflicts[0].Values) != 3 {
+		t.Errorf("The conflict should list base and both sources: %+v", conflicts[0].Values)
+	}
+}
+
+func TestMergeNonEmpty(t *testing.T) {
+	base, sources := mergeFixture()
+	merged, conflicts, err := MergeDeckboxes(base, sources, PolicyNonEmpty)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alpha, _ := merged.ById("a")
+
+	if len(alpha.Editions) != 2 || alpha.Editions[1].Set != "Beta" {
+		t.Errorf("Set values should fill in missing ones, got %+v", alpha.Editions)
+	}
+
+	if alpha.ManaCost != "{G}" {
+		t.Errorf("Two set mana costs should keep the base value, got %s", alpha.ManaCost)
+	}
+
+	if len(conflicts) != 1 || conflicts[0].Field != "mana_cost" || conflicts[0].Resolved {
+		t.Errorf("Expected one unresolved mana_cost conflict, got %+v", conflicts)
+	}
+}
+
+func TestMergeManual(t *testing.T) {
+	base, sources := mergeFixture()
+	merged, conflicts, err := MergeDeckboxes(base, sources, PolicyManual)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alpha, _ := merged.ById("a")
+
+	if alpha.ManaCost != "{G}" {
+		t.Errorf("Manual merges should keep the base value, got %s", alpha.ManaCost)
+	}
+
+	if unresolved(conflicts) != 1 {
+		t.Errorf("Expected one unresolved conflict, got %+v", conflicts)
+	}
+}
+
+func TestMergeWithoutBase(t *testing.T) {
+	_, sources := mergeFixture()
+	merged, conflicts, err := MergeDeckboxes(nil, sources, PolicyNewest)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := []string{}
+
+	for _, c := range conflicts {
+		fields = append(fields, c.Field)
+	}
+
+	if !reflect.DeepEqual(fields, []string{"mana_cost", "rules_text"}) {
+		t.Errorf("Without a base every difference conflicts, got %v", fields)
+	}
+
+	alpha, _ := merged.ById("a")
+
+	if alpha.ManaCost != "{2}{G}" || alpha.RulesText[0] != "Flying" {
+		t.Errorf("The newest values should win: %+v", alpha)
+	}
+
+	if _, _, err := MergeDeckboxes(nil, sources, "oldest"); err == nil {
+		t.Errorf("Unknown policies should be an error")
+	}
+}
+
+func TestCrawlTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frantic")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cards.json")
+	ioutil.WriteFile(path, []byte("[]"), 0644)
+	modified := time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+	os.Chtimes(path, modified, modified)
+
+	crawled := &Deckbox{Header: Header{SchemaVersion: 1, GeneratedAt: "2013-02-01T18:30:00Z"}}
+
+	if when, err := crawlTime(path, crawled); err != nil || !when.Equal(time.Date(2013, 2, 1, 18, 30, 0, 0, time.UTC)) {
+		t.Errorf("The header's time should win over the file's: %v %v", when, err)
+	}
+
+	if when, err := crawlTime(path, &Deckbox{}); err != nil || !when.Equal(modified) {
+		t.Errorf("Version 0 files should use their modification time: %v %v", when, err)
+	}
+
+	if _, err := crawlTime(path, &Deckbox{Header: Header{SchemaVersion: 1}}); err == nil {
+		t.Errorf("A header without a time should be an error")
+	}
+}
+
+func TestMergeCommandManual(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frantic")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	base, sources := mergeFixture()
+	args := []string{"-policy", "manual", "-base", filepath.Join(dir, "base.json"), "-o", filepath.Join(dir, "out.json")}
+	base.Flush(filepath.Join(dir, "base.json"))
+
+	for _, s := range sources {
+		path := filepath.Join(dir, s.Name)
+		s.Box.Flush(path)
+		args = append(args, path)
+	}
+
+	if err := mergeCommand(args); err == nil {
+		t.Errorf("Unresolved conflicts should be an error")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "out.json")); !os.IsNotExist(err) {
+		t.Errorf("Nothing should be written while conflicts are unresolved")
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Files written by Flush wrap the cards in an envelope that records which
+// version of the format they use:
+//
+//	{"schema_version": 1, "generated_at": "...", "source": "...", "card_count": 2, "cards": [...]}
+//
+// JSON Lines files start with the same header, without the cards, on its own
+// line. Files without a header, including the original bare JSON array, are
+// version 0. Older files are upgraded on load by running every migration
+// after their version in order.
+
+type Header struct {
+	SchemaVersion int `json:"schema_version"`
+	// When the crawl that produced the file ran, in RFC 3339
+	GeneratedAt string `json:"generated_at,omitempty"`
+	// Where the cards came from
+	Source string `json:"source,omitempty"`
+	// The number of cards when the file was last rewritten. Cards appended
+	// to a JSON Lines file since aren't counted.
+	CardCount int `json:"card_count"`
+}
+
+// The cards come last so readers can stream them after the header
+type envelope struct {
+	Header
+	Cards []Card `json:"cards"`
+}
+
+// A Migration upgrades the previous version of the format to Version
+type Migration struct {
+	Version     int
+	Description string
+	// Rewrite the fields of a single card before it's decoded, for renamed
+	// fields and changed types. Optional.
+	Card func(card map[string]json.RawMessage) error
+	// Fix up the whole database once it's loaded. Optional.
+	Box func(box *Deckbox) error
+}
+
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "Use oracle ids instead of hashes of name and mana cost, merging cards that share a name",
+		Box: func(box *Deckbox) error {
+			box.migratedIds = box.MigrateIds()
+			return nil
+		},
+	},
+}
+
+// The version written by Flush
+func currentSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// Whether cards from a file at version need rewriting before they're decoded
+func needsCardMigration(version int) bool {
+	for _, m := range migrations {
+		if m.Version > version && m.Card != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether a file at version has to be loaded whole to be upgraded
+func needsBoxMigration(version int) bool {
+	for _, m := range migrations {
+		if m.Version > version && m.Box != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Decode a card written at version, running every card migration since
+func migrateCard(fields map[string]json.RawMessage, version int) (Card, error) {
+	var card Card
+
+	for _, m := range migrations {
+		if m.Version <= version || m.Card == nil {
+			continue
+		}
+
+		err := m.Card(fields)
+
+		if err != nil {
+			return card, fmt.Errorf("migrating to version %d: %s", m.Version, err)
+		}
+	}
+
+	err := fromFields(fields, &card)
+	return card, err
+}
+
+// Run every database migration after the version the box was loaded from
+func (d *Deckbox) upgrade() error {
+	from := d.Header.SchemaVersion
+
+	if from > currentSchemaVersion() {
+		return fmt.Errorf("schema version %d is newer than this version of frantic supports (%d)",
+			from, currentSchemaVersion())
+	}
+
+	for _, m := range migrations {
+		if m.Version <= from {
+			continue
+		}
+
+		if m.Box != nil {
+			err := m.Box(d)
+
+			if err != nil {
+				return fmt.Errorf("migrating to version %d: %s", m.Version, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// The header written with the cards
+func (d *Deckbox) header() Header {
+	h := d.Header
+	h.SchemaVersion = currentSchemaVersion()
+	h.CardCount = len(d.Cards)
+	return h
+}
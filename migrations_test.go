@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadBareArrayAsVersionZero(t *testing.T) {
+	card := Card{Name: "Elspeth Tirel", ManaCost: "{3}{W}{W}"}
+	card.Id = legacyId(card)
+
+	blob, _ := json.Marshal([]Card{card})
+
+	var box Deckbox
+	err := json.Unmarshal(blob, &box)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if box.Header.SchemaVersion != 0 {
+		t.Errorf("A bare array should be version 0, not %d", box.Header.SchemaVersion)
+	}
+
+	if box.Cards[0].Id != OracleId(card.Name) {
+		t.Errorf("Loading version 0 should migrate ids, got %s", box.Cards[0].Id)
+	}
+
+	if box.migratedIds[card.Id] != OracleId(card.Name) {
+		t.Errorf("The id migration should be recorded: %v", box.migratedIds)
+	}
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	box := Deckbox{
+		Header: Header{GeneratedAt: "2013-01-02T03:04:05Z", Source: "test"},
+		Cards:  []Card{Card{Id: "FOO", Name: "Foo"}, Card{Id: "BAR", Name: "Bar"}},
+	}
+
+	blob, err := json.Marshal(&box)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(string(blob), `{"schema_version":1,"generated_at":"2013-01-02T03:04:05Z","source":"test","card_count":2,"cards":[`) {
+		t.Errorf("The header should come before the cards: %s", blob)
+	}
+
+	var loaded Deckbox
+	err = json.Unmarshal(blob, &loaded)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Header.SchemaVersion != 1 || loaded.Header.Source != "test" || loaded.Header.CardCount != 2 {
+		t.Errorf("Header didn't survive a round trip: %+v", loaded.Header)
+	}
+
+	if len(loaded.Cards) != 2 || loaded.Cards[0].Id != "FOO" {
+		t.Errorf("Cards at the current version shouldn't change: %+v", loaded.Cards)
+	}
+}
+
+func TestEnvelopeFieldsAfterCards(t *testing.T) {
+	card := Card{Name: "Elspeth Tirel", ManaCost: "{3}{W}{W}"}
+	card.Id = legacyId(card)
+	cards, _ := json.Marshal([]Card{card})
+
+	var box Deckbox
+	err := json.Unmarshal([]byte(`{"schema_version":0,"cards":`+string(cards)+`,"source":"late"}`), &box)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if box.Header.Source != "late" {
+		t.Errorf("Fields after the cards should be read, got %+v", box.Header)
+	}
+
+	// The version only comes after the cards
+	box = Deckbox{}
+	err = json.Unmarshal([]byte(`{"cards":`+string(cards)+`,"schema_version":0,"source":"late"}`), &box)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if box.Header.SchemaVersion != 0 || box.Header.Source != "late" {
+		t.Errorf("Fields after the cards should be read, got %+v", box.Header)
+	}
+
+	if len(box.Cards) != 1 || box.Cards[0].Id != OracleId(card.Name) {
+		t.Errorf("Cards should be upgraded from the version after them: %+v", box.Cards)
+	}
+}
+
+func TestJSONLinesHeader(t *testing.T) {
+	withHeader := readAll(t, "{\"schema_version\": 1}\n{\"id\": \"A\"}\n{\"id\": \"B\"}\n")
+	without := readAll(t, "{\"id\": \"A\", \"name\": \"Foo\"}\n{\"id\": \"B\"}\n")
+
+	if len(withHeader) != 2 || withHeader[0].Id != "A" {
+		t.Errorf("The header line shouldn't be read as a card: %+v", withHeader)
+	}
+
+	if len(without) != 2 || without[0].Id != "A" || without[0].Name != "Foo" {
+		t.Errorf("The first line should be a card when there's no header: %+v", without)
+	}
+
+	dir, err := ioutil.TempDir("", "frantic")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cards.jsonl")
+	err = AppendCards(path, []Card{Card{Id: OracleId("Foo"), Name: "Foo"}})
+
+	if err == nil {
+		err = AppendCards(path, []Card{Card{Id: OracleId("Bar"), Name: "Bar"}})
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blob, _ := ioutil.ReadFile(path)
+
+	if strings.Count(string(blob), "schema_version") != 1 {
+		t.Errorf("Only a new file should get a header:\n%s", blob)
+	}
+}
+
+func TestCardMigrations(t *testing.T) {
+	defer func(saved []Migration) { migrations = saved }(migrations)
+
+	migrations = append(migrations, Migration{
+		Version:     2,
+		Description: "Rename text to rules_text",
+		Card: func(card map[string]json.RawMessage) error {
+			if text, found := card["text"]; found {
+				card["rules_text"] = text
+				delete(card, "text")
+			}
+			return nil
+		},
+	})
+
+	cards := readAll(t, `{"schema_version": 1, "cards": [{"id": "A", "text": ["Flying"]}]}`)
+
+	if len(cards) != 1 || len(cards[0].RulesText) != 1 || cards[0].RulesText[0] != "Flying" {
+		t.Errorf("Renamed field wasn't migrated: %+v", cards)
+	}
+
+	current := readAll(t, `{"schema_version": 2, "cards": [{"id": "A", "text": ["Flying"]}]}`)
+
+	if len(current) != 1 || len(current[0].RulesText) != 0 {
+		t.Errorf("Cards at the current version shouldn't be migrated: %+v", current)
+	}
+}
+
+func TestNewerSchemaVersion(t *testing.T) {
+	var box Deckbox
+	err := json.Unmarshal([]byte(`{"schema_version": 99, "cards": []}`), &box)
+
+	if err == nil {
+		t.Errorf("Files from a newer version of frantic shouldn't load")
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Cards in the layout of version 3 of MTGJSON's AllCards.json and
+// AllSets.json. Gatherer doesn't give us everything MTGJSON has, so the
+// README lists the fields that are left out.
+
+type MTGJSONCard struct {
+	Layout            string   `json:"layout"`
+	Name              string   `json:"name"`
+	Names             []string `json:"names,omitempty"`
+	ManaCost          string   `json:"manaCost,omitempty"`
+	ConvertedManaCost float64  `json:"cmc"`
+	Colors            []string `json:"colors,omitempty"`
+	ColorIdentity     []string `json:"colorIdentity,omitempty"`
+	Type              string   `json:"type"`
+	Supertypes        []string `json:"supertypes,omitempty"`
+	Types             []string `json:"types,omitempty"`
+	Subtypes          []string `json:"subtypes,omitempty"`
+	Text              string   `json:"text,omitempty"`
+	Power             string   `json:"power,omitempty"`
+	Toughness         string   `json:"toughness,omitempty"`
+	Loyalty           int      `json:"loyalty,omitempty"`
+	Printings         []string `json:"printings"`
+
+	// Only set on the cards in AllSets.json
+	Artist       string `json:"artist,omitempty"`
+	FlavorText   string `json:"flavor,omitempty"`
+	MultiverseId int    `json:"multiverseid,omitempty"`
+	Number       string `json:"number,omitempty"`
+	Rarity       string `json:"rarity,omitempty"`
+	Watermark    string `json:"watermark,omitempty"`
+}
+
+type MTGJSONSet struct {
+	Name string `json:"name"`
+	// Gatherer doesn't show set codes, so this is the set's name too
+	Code  string        `json:"code"`
+	Cards []MTGJSONCard `json:"cards"`
+}
+
+// Gatherer's rarities are the class of the set symbol
+var mtgjsonRarities = map[string]string{
+	"common":   "Common",
+	"uncommon": "Uncommon",
+	"rare":     "Rare",
+	"mythic":   "Mythic Rare",
+	"special":  "Special",
+	"land":     "Basic Land",
+}
+
+var supertypes = []string{"basic", "legendary", "ongoing", "snow", "world"}
+
+// The names of a card's faces in the order they're printed, by their sides.
+// Cards crawled before sides were recorded fall back to the face with a mana
+// cost as the front of a double-faced or flip card, and split cards in name
+// order.
+func faceNames(card, partner Card) []string {
+	switch {
+	case card.Side != "" && partner.Side != "" && card.Side != partner.Side:
+		if card.Side < partner.Side {
+			return []string{card.Name, partner.Name}
+		}
+		return []string{partner.Name, card.Name}
+	case card.ManaCost != "" && partner.ManaCost == "":
+		return []string{card.Name, partner.Name}
+	case card.ManaCost == "" && partner.ManaCost != "":
+		return []string{partner.Name, card.Name}
+	case card.Name < partner.Name:
+		return []string{card.Name, partner.Name}
+	}
+	return []string{partner.Name, card.Name}
+}
+
+func capitalizeAll(values []string) []string {
+	capitalized := []string{}
+
+	for _, v := range values {
+		capitalized = append(capitalized, capitalize(v))
+	}
+
+	return capitalized
+}
+
+// Colors as capitalized names in WUBRG order, e.g. ["Blue", "Red"]
+func colorNames(colors map[string]bool) []string {
+	names := []string{}
+
+	for _, letter := range "wubrg" {
+		if colors[colorLetters[letter]] {
+			names = append(names, capitalize(colorLetters[letter]))
+		}
+	}
+
+	return names
+}
+
+// A card as it appears in AllCards.json
+func toMTGJSON(box *Deckbox, card Card) MTGJSONCard {
+	m := MTGJSONCard{
+		Layout:            card.Special,
+		Name:              card.Name,
+		ManaCost:          card.ManaCost,
+		ConvertedManaCost: card.ConvertedCost,
+		Colors:            colorNames(cardColors(card)),
+		Type:              card.TypeLine(),
+		Subtypes:          capitalizeAll(card.Subtypes),
+		Text:              strings.Join(card.RulesText, "\n"),
+		Power:             card.Power,
+		Toughness:         card.Toughness,
+		Loyalty:           card.Loyalty,
+		Printings:         []string{},
+	}
+
+	// Gatherer's special layouts have the same names in MTGJSON
+	if m.Layout == "" {
+		m.Layout = "normal"
+	}
+
+	for _, t := range card.Types {
+		if contains(supertypes, t) {
+			m.Supertypes = append(m.Supertypes, capitalize(t))
+		} else {
+			m.Types = append(m.Types, capitalize(t))
+		}
+	}
+
+	identity := colorIdentity(card)
+
+	if partner, found := box.ById(card.PartnerCard); card.PartnerCard != "" && found {
+		m.Names = faceNames(card, partner)
+
+		for color := range colorIdentity(partner) {
+			identity[color] = true
+		}
+
+		// MTGJSON gives both halves of a split card the cost of the whole
+		// card
+		if card.Special == "split" {
+			m.ConvertedManaCost = card.ConvertedCost + partner.ConvertedCost
+		}
+	}
+
+	m.ColorIdentity = colorCodes(identity)
+
+	for _, e := range card.Editions {
+		if e.Set != "" && !contains(m.Printings, e.Set) {
+			m.Printings = append(m.Printings, e.Set)
+		}
+	}
+
+	sort.Strings(m.Printings)
+	return m
+}
+
+// A printing as it appears in a set in AllSets.json
+func toMTGJSONPrinting(box *Deckbox, card Card, e Edition) MTGJSONCard {
+	m := toMTGJSON(box, card)
+	m.Artist = e.Artist
+	m.FlavorText = strings.Join(e.FlavorText, "\n")
+	m.MultiverseId = e.MultiverseId
+	m.Number = e.Number
+	m.Rarity = mtgjsonRarities[e.Rarity]
+
+	if m.Rarity == "" {
+		m.Rarity = capitalize(e.Rarity)
+	}
+	m.Watermark = e.Watermark
+	return m
+}
+
+// Every card by name, as in AllCards.json
+func MTGJSONCards(box *Deckbox) map[string]MTGJSONCard {
+	cards := map[string]MTGJSONCard{}
+
+	for _, card := range box.Cards {
+		cards[card.Name] = toMTGJSON(box, card)
+	}
+
+	return cards
+}
+
+// Every set by name, as in AllSets.json. Printings without a set are left
+// out.
+func MTGJSONSets(box *Deckbox) map[string]MTGJSONSet {
+	sets := map[string]MTGJSONSet{}
+
+	for _, card := range box.Cards {
+		for _, e := range card.Editions {
+			if e.Set == "" {
+				continue
+			}
+
+			set, found := sets[e.Set]
+
+			if !found {
+				set = MTGJSONSet{Name: e.Set, Code: e.Set}
+			}
+
+			set.Cards = append(set.Cards, toMTGJSONPrinting(box, card, e))
+			sets[e.Set] = set
+		}
+	}
+
+	for _, set := range sets {
+		sort.SliceStable(set.Cards, func(i, j int) bool {
+			return lessNumber(set.Cards[i].Number, set.Cards[j].Number)
+		})
+	}
+
+	return sets
+}
+
+// Order collector numbers like 9, 10, 10a and 10b
+func lessNumber(a, b string) bool {
+	na, _ := strconv.Atoi(strings.TrimRightFunc(a, isNotDigit))
+	nb, _ := strconv.Atoi(strings.TrimRightFunc(b, isNotDigit))
+
+	if na != nb {
+		return na < nb
+	}
+	return a < b
+}
+
+func isNotDigit(r rune) bool {
+	return r < '0' || r > '9'
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	blob, err := json.MarshalIndent(v, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, append(blob, '\n'), FlushOptions{}, nil)
+}
+
+// Write AllCards.json and AllSets.json to the output directory
+func exportMTGJSON(box *Deckbox, opts ExportOptions) error {
+	err := os.MkdirAll(opts.Output, 0755)
+
+	if err != nil {
+		return err
+	}
+
+	err = writeJSONFile(filepath.Join(opts.Output, "AllCards.json"), MTGJSONCards(box))
+
+	if err != nil {
+		return err
+	}
+
+	return writeJSONFile(filepath.Join(opts.Output, "AllSets.json"), MTGJSONSets(box))
+}
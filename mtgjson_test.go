@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func mtgjsonBox() *Deckbox {
+	cards := []Card{
+		Card{Name: "Huntmaster of the Fells", Types: []string{"creature"}, Subtypes: []string{"human", "werewolf"},
+			ManaCost: "{2}{R}{G}", ConvertedCost: 4, Special: "double-faced", Power: "2", Toughness: "2",
+			RulesText: []string{"At the beginning of each upkeep, if no spells were cast last turn, transform Huntmaster of the Fells."},
+			Editions:  []Edition{Edition{MultiverseId: 262875, Set: "Dark Ascension", Rarity: "mythic", Artist: "Chris Rahn", Number: "140a"}}},
+		Card{Name: "Ravager of the Fells", Types: []string{"creature"}, Subtypes: []string{"werewolf"},
+			ConvertedCost: 4, Special: "double-faced", ColorIndicator: []string{"red", "green"}, Power: "4", Toughness: "4",
+			Editions: []Edition{Edition{MultiverseId: 262699, Set: "Dark Ascension", Rarity: "mythic", Artist: "Chris Rahn", Number: "140b"}}},
+		Card{Name: "Stand", Types: []string{"instant"}, ManaCost: "{W}", ConvertedCost: 1, Special: "split",
+			Editions: []Edition{Edition{MultiverseId: 20574, Set: "Invasion", Rarity: "uncommon", Number: "292"}}},
+		Card{Name: "Deliver", Types: []string{"instant"}, ManaCost: "{2}{U}", ConvertedCost: 3, Special: "split",
+			Editions: []Edition{Edition{MultiverseId: 20574, Set: "Invasion", Rarity: "uncommon", Number: "292"}}},
+		Card{Name: "Karn Liberated", Types: []string{"legendary", "planeswalker"}, Subtypes: []string{"karn"},
+			ManaCost: "{7}", ConvertedCost: 7, Loyalty: 6,
+			Editions: []Edition{
+				Edition{MultiverseId: 220}, Edition{MultiverseId: 221, Set: "New Phyrexia", Rarity: "mythic", Number: "1"},
+				Edition{MultiverseId: 222, Set: "Modern Masters 2015", Rarity: "mythic", Number: "4"},
+			}},
+		Card{Name: "Birds of Paradise", Types: []string{"creature"}, ManaCost: "{G}", ConvertedCost: 1,
+			RulesText: []string{"Flying", "{T}: Add one mana of any color to your mana pool."},
+			Editions: []Edition{
+				Edition{MultiverseId: 10, Set: "Invasion", Number: "10", FlavorText: []string{"“Their wings,”", "she said."}},
+			}},
+	}
+
+	for i := range cards {
+		cards[i].Id = OracleId(cards[i].Name)
+	}
+
+	cards[0].PartnerCard, cards[1].PartnerCard = cards[1].Id, cards[0].Id
+	cards[2].PartnerCard, cards[3].PartnerCard = cards[3].Id, cards[2].Id
+	cards[0].Side, cards[1].Side = "a", "b"
+	cards[2].Side, cards[3].Side = "a", "b"
+
+	return &Deckbox{Cards: cards}
+}
+
+func TestMTGJSONCards(t *testing.T) {
+	cards := MTGJSONCards(mtgjsonBox())
+
+	ravager := cards["Ravager of the Fells"]
+	expected := MTGJSONCard{
+		Layout:            "double-faced",
+		Name:              "Ravager of the Fells",
+		Names:             []string{"Huntmaster of the Fells", "Ravager of the Fells"},
+		ConvertedManaCost: 4,
+		Colors:            []string{"Red", "Green"},
+		ColorIdentity:     []string{"R", "G"},
+		Type:              "Creature — Werewolf",
+		Types:             []string{"Creature"},
+		Subtypes:          []string{"Werewolf"},
+		Power:             "4",
+		Toughness:         "4",
+		Printings:         []string{"Dark Ascension"},
+	}
+
+	if !reflect.DeepEqual(ravager, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, ravager)
+	}
+
+	deliver := cards["Deliver"]
+
+	if !reflect.DeepEqual(deliver.Names, []string{"Stand", "Deliver"}) || deliver.Layout != "split" {
+		t.Errorf("Split halves should name each other in printed order: %+v", deliver)
+	}
+
+	if deliver.ConvertedManaCost != 4 || !reflect.DeepEqual(deliver.ColorIdentity, []string{"W", "U"}) {
+		t.Errorf("Split halves should share the whole card's cost and identity: %+v", deliver)
+	}
+
+	karn := cards["Karn Liberated"]
+
+	if !reflect.DeepEqual(karn.Supertypes, []string{"Legendary"}) || !reflect.DeepEqual(karn.Types, []string{"Planeswalker"}) || karn.Loyalty != 6 {
+		t.Errorf("Karn's types or loyalty are wrong: %+v", karn)
+	}
+
+	if !reflect.DeepEqual(karn.Printings, []string{"Modern Masters 2015", "New Phyrexia"}) {
+		t.Errorf("Printings should be the sets Karn was printed in: %v", karn.Printings)
+	}
+
+	if birds := cards["Birds of Paradise"]; birds.Layout != "normal" || birds.Text != "Flying\n{T}: Add one mana of any color to your mana pool." {
+		t.Errorf("Birds are wrong: %+v", birds)
+	}
+}
+
+// Mana symbols in reminder text don't count towards color identity
+func TestMTGJSONColorIdentityReminderText(t *testing.T) {
+	card := Card{Id: "syndic", Name: "Syndic of Tithes", Types: []string{"creature"}, ManaCost: "{2}{W}", ConvertedCost: 3,
+		RulesText: []string{"Extort (Whenever you cast a spell, you may pay {W/B}. If you do, each opponent loses 1 life and you gain that much life.)"}}
+	cards := MTGJSONCards(&Deckbox{Cards: []Card{card}})
+
+	if identity := cards["Syndic of Tithes"].ColorIdentity; !reflect.DeepEqual(identity, []string{"W"}) {
+		t.Errorf("Expected a white identity, got %v", identity)
+	}
+}
+
+func TestMTGJSONSets(t *testing.T) {
+	sets := MTGJSONSets(mtgjsonBox())
+
+	if len(sets) != 4 {
+		t.Fatalf("Expected 4 sets, got %d", len(sets))
+	}
+
+	invasion := sets["Invasion"]
+	names := []string{}
+
+	for _, card := range invasion.Cards {
+		names = append(names, card.Name)
+	}
+
+	if !reflect.DeepEqual(names, []string{"Birds of Paradise", "Stand", "Deliver"}) {
+		t.Errorf("Invasion should be in collector number order: %v", names)
+	}
+
+	birds := invasion.Cards[0]
+
+	if birds.MultiverseId != 10 || birds.Number != "10" || birds.FlavorText != "“Their wings,”\nshe said." {
+		t.Errorf("Printing details are wrong: %+v", birds)
+	}
+
+	if karn := sets["New Phyrexia"].Cards[0]; karn.Rarity != "Mythic Rare" {
+		t.Errorf("Rarities should be named as in MTGJSON, got %q", karn.Rarity)
+	}
+}
+
+func TestExportMTGJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frantic")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "mtgjson")
+	err = exportMTGJSON(mtgjsonBox(), ExportOptions{Output: output})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blob, err := ioutil.ReadFile(filepath.Join(output, "AllSets.json"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sets map[string]struct {
+		Code  string
+		Cards []map[string]interface{}
+	}
+
+	err = json.Unmarshal(blob, &sets)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sets["New Phyrexia"].Cards) != 1 || sets["New Phyrexia"].Cards[0]["multiverseid"] != 221.0 {
+		t.Errorf("AllSets.json is wrong: %s", blob)
+	}
+
+	if _, err := os.Stat(filepath.Join(output, "AllCards.json")); err != nil {
+		t.Error(err)
+	}
+}
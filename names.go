@@ -0,0 +1,398 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Finding cards by the names people actually type. Names are compared by a
+// key that ignores case, accents and punctuation, so "stand/deliver" finds
+// Stand // Deliver. Typos are caught by edit distance.
+
+// A name and the cards it stands for. A split card's full name stands for
+// both halves, and a double-faced or flip card's face brings its partner
+// along.
+type NameMatch struct {
+	Name     string `json:"name"`
+	Cards    []Card `json:"cards"`
+	Distance int    `json:"distance"`
+}
+
+type nameEntry struct {
+	key   string
+	name  string
+	cards []Card
+}
+
+type NameIndex struct {
+	// Sorted by key
+	entries []nameEntry
+	byKey   map[string]int
+}
+
+// The form names are compared in, e.g. "Urza’s Avenger" is "urzas avenger"
+func nameKey(name string) string {
+	name = normalizeName(name)
+
+	var b strings.Builder
+
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		case r == '\'':
+		default:
+			b.WriteRune(' ')
+		}
+	}
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func NewNameIndex(box *Deckbox) *NameIndex {
+	n := &NameIndex{byKey: map[string]int{}}
+	entries := map[string]*nameEntry{}
+	order := []string{}
+
+	add := func(name string, cards ...Card) {
+		key := nameKey(name)
+
+		if key == "" {
+			return
+		}
+
+		entry, found := entries[key]
+
+		if !found {
+			entry = &nameEntry{key: key, name: name}
+			entries[key] = entry
+			order = append(order, key)
+		}
+
+		for _, card := range cards {
+			if !containsCard(entry.cards, card) {
+				entry.cards = append(entry.cards, card)
+			}
+		}
+	}
+
+	for _, card := range box.Cards {
+		partner, found := box.ById(card.PartnerCard)
+
+		if !found {
+			add(card.Name, card)
+			continue
+		}
+
+		add(card.Name, card, partner)
+
+		if card.Special == "split" {
+			add(strings.Join(faceNames(card, partner), " // "), card, partner)
+		}
+	}
+
+	sort.Strings(order)
+
+	for i, key := range order {
+		n.entries = append(n.entries, *entries[key])
+		n.byKey[key] = i
+	}
+
+	return n
+}
+
+func containsCard(cards []Card, card Card) bool {
+	for _, c := range cards {
+		if c.Id == card.Id {
+			return true
+		}
+	}
+	return false
+}
+
+func (e nameEntry) match(distance int) NameMatch {
+	return NameMatch{Name: e.name, Cards: e.cards, Distance: distance}
+}
+
+// Find the cards with exactly this name, up to case, accents and punctuation
+func (n *NameIndex) Lookup(name string) (NameMatch, bool) {
+	if i, found := n.byKey[nameKey(name)]; found {
+		return n.entries[i].match(0), true
+	}
+	return NameMatch{}, false
+}
+
+// Names starting with prefix, then names with a later word starting with
+// it, in alphabetical order
+func (n *NameIndex) Complete(prefix string, max int) []NameMatch {
+	prefix = nameKey(prefix)
+	matches := n.withPrefix(prefix, max)
+
+	if prefix == "" {
+		return matches
+	}
+
+	for _, e := range n.entries {
+		if len(matches) >= max {
+			break
+		}
+
+		if !strings.HasPrefix(e.key, prefix) && strings.Contains(" "+e.key, " "+prefix) {
+			matches = append(matches, e.match(0))
+		}
+	}
+
+	return matches
+}
+
+// Names whose key starts with prefix
+func (n *NameIndex) withPrefix(prefix string, max int) []NameMatch {
+	matches := []NameMatch{}
+
+	if prefix == "" {
+		return matches
+	}
+
+	start := sort.Search(len(n.entries), func(i int) bool {
+		return n.entries[i].key >= prefix
+	})
+
+	for i := start; i < len(n.entries) && len(matches) < max; i++ {
+		if !strings.HasPrefix(n.entries[i].key, prefix) {
+			break
+		}
+		matches = append(matches, n.entries[i].match(0))
+	}
+
+	return matches
+}
+
+// The closest names by edit distance, closest first. Names further than a
+// third of the name's length away aren't suggested.
+func (n *NameIndex) Suggest(name string, max int) []NameMatch {
+	key := nameKey(name)
+	limit := len([]rune(key)) / 3
+
+	if limit < 2 {
+		limit = 2
+	}
+
+	matches := []NameMatch{}
+
+	for _, e := range n.entries {
+		if d := editDistance(key, e.key, limit); d <= limit {
+			matches = append(matches, e.match(d))
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Distance < matches[j].Distance
+	})
+
+	if len(matches) > max {
+		matches = matches[:max]
+	}
+
+	return matches
+}
+
+func matchNames(matches []NameMatch) []string {
+	names := []string{}
+
+	for _, m := range matches {
+		names = append(names, m.Name)
+	}
+
+	return names
+}
+
+// A name that didn't match any card
+type NameNotFound struct {
+	Name        string
+	Suggestions []NameMatch
+}
+
+func (e NameNotFound) Error() string {
+	if len(e.Suggestions) == 0 {
+		return fmt.Sprintf("no card named %q", e.Name)
+	}
+
+	names := []string{}
+
+	for _, s := range e.Suggestions {
+		names = append(names, s.Name)
+	}
+
+	return fmt.Sprintf("no card named %q, did you mean %s?", e.Name, strings.Join(names, ", "))
+}
+
+// Find the card someone meant: an exact match, the only name starting with
+// what they typed, or the single closest name. Anything else is a
+// NameNotFound with suggestions. The distance of a prefix match is the
+// number of letters left off.
+func (n *NameIndex) Find(name string) (NameMatch, error) {
+	if m, found := n.Lookup(name); found {
+		return m, nil
+	}
+
+	key := nameKey(name)
+
+	if prefixed := n.withPrefix(key, 2); len(prefixed) == 1 {
+		m := prefixed[0]
+		m.Distance = len([]rune(nameKey(m.Name))) - len([]rune(key))
+		return m, nil
+	}
+
+	suggestions := n.Suggest(name, 5)
+
+	if len(suggestions) == 1 || (len(suggestions) > 1 && suggestions[0].Distance < suggestions[1].Distance) {
+		return suggestions[0], nil
+	}
+
+	if len(suggestions) == 0 {
+		suggestions = n.Complete(name, 5)
+	}
+
+	return NameMatch{}, NameNotFound{Name: name, Suggestions: suggestions}
+}
+
+// The optimal string alignment distance between a and b: insertions,
+// deletions, substitutions and swaps of adjacent letters. Gives up and
+// returns limit+1 once the distance must be more than limit.
+func editDistance(a, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+
+	if d := len(ra) - len(rb); d > limit || -d > limit {
+		return limit + 1
+	}
+
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	row := make([]int, len(rb)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		row[0] = i
+		best := row[0]
+
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			row[j] = minInt(prev[j]+1, row[j-1]+1, prev[j-1]+cost)
+
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				row[j] = minInt(row[j], prev2[j-2]+1)
+			}
+
+			if row[j] < best {
+				best = row[j]
+			}
+		}
+
+		if best > limit {
+			return limit + 1
+		}
+
+		prev2, prev, row = prev, row, prev2
+	}
+
+	return prev[len(rb)]
+}
+
+func minInt(first int, rest ...int) int {
+	for _, n := range rest {
+		if n < first {
+			first = n
+		}
+	}
+	return first
+}
+
+// Print a card the way it reads, followed by its printings
+func writeCard(w io.Writer, card Card) {
+	fmt.Fprintln(w, formatCardLine(card))
+
+	for _, p := range card.RulesText {
+		fmt.Fprintf(w, "    %s\n", p)
+	}
+
+	for _, e := range card.Editions {
+		parts := []string{}
+
+		for _, part := range []string{e.Set, e.Rarity, e.Number, e.Artist} {
+			if part != "" {
+				parts = append(parts, part)
+			}
+		}
+
+		fmt.Fprintf(w, "    [%d] %s\n", e.MultiverseId, strings.Join(parts, ", "))
+	}
+}
+
+// frantic show [-db cards.json] [-json] [-complete] name ...
+func showCommand(args []string) error {
+	flags := flag.NewFlagSet("show", flag.ExitOnError)
+	dbPath := flags.String("db", "cards.json", "The database to look in")
+	asJSON := flags.Bool("json", false, "Print the cards as JSON")
+	complete := flags.Bool("complete", false, "List names starting with the name instead")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		return fmt.Errorf("usage: show [-db cards.json] [-json] [-complete] name ...")
+	}
+
+	name := strings.Join(flags.Args(), " ")
+	box, err := openDeckbox(*dbPath)
+
+	if err != nil {
+		return err
+	}
+
+	names := NewNameIndex(&box)
+
+	if *complete {
+		for _, m := range names.Complete(name, 20) {
+			fmt.Println(m.Name)
+		}
+		return nil
+	}
+
+	match, err := names.Find(name)
+
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		blob, err := json.MarshalIndent(match.Cards, "", "  ")
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(blob))
+		return nil
+	}
+
+	for i, card := range match.Cards {
+		if i > 0 {
+			fmt.Println()
+		}
+		writeCard(os.Stdout, card)
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"testing"
+)
+
+func nameBox() *Deckbox {
+	cards := []Card{
+		Card{Name: "Huntmaster of the Fells", Special: "double-faced"},
+		Card{Name: "Ravager of the Fells", Special: "double-faced"},
+		Card{Name: "Stand", Special: "split", Side: "a"},
+		Card{Name: "Deliver", Special: "split", Side: "b"},
+		Card{Name: "Æther Vial"},
+		Card{Name: "Urza’s Avenger"},
+		Card{Name: "Hunted Wumpus"},
+		Card{Name: "Lord of the Pit"},
+		Card{Name: "Lord of Atlantis"},
+	}
+
+	for i := range cards {
+		cards[i].Id = OracleId(cards[i].Name)
+	}
+
+	cards[0].PartnerCard, cards[1].PartnerCard = cards[1].Id, cards[0].Id
+	cards[2].PartnerCard, cards[3].PartnerCard = cards[3].Id, cards[2].Id
+
+	return &Deckbox{Cards: cards}
+}
+
+func TestNameKey(t *testing.T) {
+	tests := map[string]string{
+		"Stand // Deliver": "stand deliver",
+		"stand/deliver":    "stand deliver",
+		"Urza’s Avenger":   "urzas avenger",
+		"urzas avenger":    "urzas avenger",
+		" AETHER  vial ":   "aether vial",
+		"Æther Vial":       "aether vial",
+	}
+
+	for name, expected := range tests {
+		if key := nameKey(name); key != expected {
+			t.Errorf("%q should have key %q, not %q", name, expected, key)
+		}
+	}
+}
+
+func TestFindName(t *testing.T) {
+	names := NewNameIndex(nameBox())
+
+	tests := map[string][]string{
+		"huntmaster of the fels": {"Huntmaster of the Fells", "Ravager of the Fells"},
+		"ravager of the fells":   {"Ravager of the Fells", "Huntmaster of the Fells"},
+		"stand/deliver":          {"Stand", "Deliver"},
+		"Stand // Deliver":       {"Stand", "Deliver"},
+		"deliver":                {"Deliver", "Stand"},
+		"aether vial":            {"Æther Vial"},
+		"urzas avenger":          {"Urza’s Avenger"},
+		"urza's avneger":         {"Urza’s Avenger"},
+		"hunted":                 {"Hunted Wumpus"},
+	}
+
+	for name, expected := range tests {
+		m, err := names.Find(name)
+
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+
+		cards := []string{}
+
+		for _, card := range m.Cards {
+			cards = append(cards, card.Name)
+		}
+
+		if len(cards) != len(expected) {
+			t.Errorf("%s found %v, not %v", name, cards, expected)
+			continue
+		}
+
+		for i := range cards {
+			if cards[i] != expected[i] {
+				t.Errorf("%s found %v, not %v", name, cards, expected)
+				break
+			}
+		}
+	}
+}
+
+func TestFindNameAmbiguous(t *testing.T) {
+	names := NewNameIndex(nameBox())
+
+	_, err := names.Find("lord of")
+	notFound, ok := err.(NameNotFound)
+
+	if !ok {
+		t.Fatalf("An ambiguous prefix should be NameNotFound, got %v", err)
+	}
+
+	if s := matchNames(notFound.Suggestions); len(s) != 2 || s[0] != "Lord of Atlantis" || s[1] != "Lord of the Pit" {
+		t.Errorf("Both lords should be suggested: %v", s)
+	}
+
+	if _, err := names.Find("Black Lotus"); err == nil {
+		t.Errorf("Black Lotus isn't in the box")
+	}
+}
+
+func TestCompleteName(t *testing.T) {
+	names := NewNameIndex(nameBox())
+
+	completions := matchNames(names.Complete("hun", 10))
+	expected := []string{"Hunted Wumpus", "Huntmaster of the Fells"}
+
+	if len(completions) != 2 || completions[0] != expected[0] || completions[1] != expected[1] {
+		t.Errorf("Expected %v, got %v", expected, completions)
+	}
+
+	completions = matchNames(names.Complete("fell", 10))
+
+	if len(completions) != 2 {
+		t.Errorf("Later words should complete too: %v", completions)
+	}
+
+	if completions := names.Complete("lord", 1); len(completions) != 1 {
+		t.Errorf("Completions should stop at the maximum: %v", matchNames(completions))
+	}
+
+	completions = matchNames(names.Complete("deliver", 10))
+
+	for _, name := range completions {
+		if name == "Deliver // Stand" {
+			t.Errorf("Split cards should only complete in printed order: %v", completions)
+		}
+	}
+
+	if completions = matchNames(names.Complete("stand", 10)); len(completions) != 2 || completions[1] != "Stand // Deliver" {
+		t.Errorf("Expected Stand and Stand // Deliver, got %v", completions)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"fells", "fels", 1},
+		{"avneger", "avenger", 1},
+		{"kitten", "sitting", 3},
+		{"", "abc", 3},
+		{"same", "same", 0},
+	}
+
+	for _, test := range tests {
+		if d := editDistance(test.a, test.b, 10); d != test.expected {
+			t.Errorf("Distance from %q to %q should be %d, not %d", test.a, test.b, test.expected, d)
+		}
+	}
+
+	if d := editDistance("kitten", "sitting", 1); d != 2 {
+		t.Errorf("Distances over the limit should be limit+1, not %d", d)
+	}
+}
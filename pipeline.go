@@ -1,27 +1,43 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"os"
+	"reflect"
 	"runtime"
 	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Deckbox struct {
-	Cards []Card
+	// Read from the file the cards were loaded from. SchemaVersion is the
+	// version they were upgraded from.
+	Header Header
+	Cards  []Card
+	idx    deckIndex
+	// Old ids to new, from the migration to oracle ids
+	migratedIds map[string]string
+	// Built by TextIndex and kept up to date by Add
+	text *TextIndex
 }
 
 func (d *Deckbox) UnmarshalJSON(blob []byte) error {
-	return json.Unmarshal(blob, &d.Cards)
+	box, err := readDeckbox(bytes.NewReader(blob))
+	*d = box
+	return err
 }
 
 func (d *Deckbox) MarshalJSON() ([]byte, error) {
-	return json.Marshal(d.Cards)
+	return json.Marshal(envelope{Header: d.header(), Cards: d.Cards})
 }
 
 func (d *Deckbox) Len() int {
@@ -29,32 +45,85 @@ func (d *Deckbox) Len() int {
 }
 
 func (d *Deckbox) Swap(i, j int) {
-	d.Cards[i], d.Cards[j] = d.Cards[j], d.Cards[i]
+	d.swapCards(i, j)
 }
 
 func (d *Deckbox) Less(i, j int) bool {
-	return d.Cards[i].Name < d.Cards[j].Name
+	if d.Cards[i].Name != d.Cards[j].Name {
+		return d.Cards[i].Name < d.Cards[j].Name
+	}
+	return d.Cards[i].Id < d.Cards[j].Id
+}
+
+// Put cards in name and id order, and each card's editions in multiverse
+// id order, so the same cards always serialize to the same bytes
+func (d *Deckbox) Sort() {
+	sort.Sort(d)
+
+	for _, card := range d.Cards {
+		sortEditions(card.Editions)
+	}
+
+	d.reindex()
+}
+
+func sortEditions(editions []Edition) {
+	sort.SliceStable(editions, func(i, j int) bool {
+		a, b := editions[i], editions[j]
+
+		if a.MultiverseId != b.MultiverseId {
+			return a.MultiverseId < b.MultiverseId
+		}
+		if a.Set != b.Set {
+			return a.Set < b.Set
+		}
+		return a.Number < b.Number
+	})
 }
 
 func (d *Deckbox) Flush(path string) error {
-	blob, err := json.Marshal(d)
+	return d.FlushWith(path, flushOptions)
+}
+
+// Write the deckbox to path atomically, see writeFileAtomic. The cards are
+// sorted first.
+func (d *Deckbox) FlushWith(path string, opts FlushOptions) error {
+	d.Sort()
+
+	var blob []byte
+	var err error
+
+	if opts.Indent != "" {
+		blob, err = json.MarshalIndent(d, "", opts.Indent)
+		blob = append(blob, '\n')
+	} else {
+		blob, err = json.Marshal(d)
+	}
 
 	if err != nil {
 		return err
 	}
 
-	err = ioutil.WriteFile(path, blob, 0644)
+	err = writeFileAtomic(path, blob, opts, verifyDeckbox(len(d.Cards)))
 
-	if err != nil {
-		return err
+	if err == nil {
+		d.Header.SchemaVersion = currentSchemaVersion()
 	}
-	return nil
+
+	return err
 }
 
-// Return a map of all card ids
+// Return a map of all card ids. It's a copy, use ById to look one up.
 func (d *Deckbox) IdSet() map[string]bool {
 	set := map[string]bool{}
 
+	if d.indexed() {
+		for id := range d.idx.ids {
+			set[id] = true
+		}
+		return set
+	}
+
 	for _, card := range d.Cards {
 		set[card.Id] = true
 	}
@@ -62,70 +131,191 @@ func (d *Deckbox) IdSet() map[string]bool {
 	return set
 }
 
-// Return a map of all Multiverse ids
+// Return a map of all Multiverse ids. It's a copy, use ByMultiverseId to
+// look one up.
 func (d *Deckbox) MultiverseSet() map[int]bool {
 	set := map[int]bool{}
 
+	if d.indexed() {
+		for id, positions := range d.idx.multiverse {
+			if len(positions) > 0 {
+				set[id] = true
+			}
+		}
+		return set
+	}
+
 	for _, card := range d.Cards {
-		for _, edition := range card.Editions {
-			set[edition.MultiverseId] = true
+		for _, e := range card.Editions {
+			set[e.MultiverseId] = true
 		}
 	}
 
 	return set
 }
 
-// Add a card to the deckbox
+// Add a card to the deckbox, merging it into any card with the same id
 func (d *Deckbox) Add(newCard Card) error {
 	if len(newCard.Editions) == 0 {
 		return fmt.Errorf("%s has no editions", newCard.Name)
 	}
 
-	for i, c := range d.Cards {
-		if c.Id == newCard.Id {
-			for _, newe := range newCard.Editions {
-				found := false
-				for j, olde := range c.Editions {
-					if olde.MultiverseId == newe.MultiverseId {
-						found = true
-						if olde.Set == "" && newe.Set != "" {
-							d.Cards[i].Editions[j] = newe
-						}
-					}
-				}
+	d.merge(newCard, false)
+	return nil
+}
 
-				if !found {
-					d.Cards[i].Editions = append(newCard.Editions, newe)
-				}
-			}
-			return nil
-		}
+// Add a freshly crawled card, whose set values replace the stored ones
+func (d *Deckbox) Refresh(newCard Card) error {
+	if len(newCard.Editions) == 0 {
+		return fmt.Errorf("%s has no editions", newCard.Name)
 	}
 
-	d.Cards = append(d.Cards, newCard)
+	d.merge(newCard, true)
 	return nil
 }
 
+func (d *Deckbox) merge(newCard Card, fresh bool) {
+	if !d.indexed() {
+		d.reindex()
+	}
+
+	i, found := d.position(newCard.Id)
+
+	if found {
+		d.unindexCard(i)
+		d.Cards[i] = mergeCards(d.Cards[i], newCard, fresh)
+		d.indexCard(i)
+	} else {
+		d.Cards = append(d.Cards, mergeCards(Card{}, newCard, fresh))
+		i = len(d.Cards) - 1
+		d.indexCard(i)
+	}
+
+	if d.text != nil {
+		d.text.Update(d.Cards[i])
+	}
+}
+
+// Load a database stored as either a JSON array or JSON Lines
 func loadDeckBox(path string) (Deckbox, error) {
-	blob, err := ioutil.ReadFile(path)
+	file, err := os.Open(path)
 
 	if err != nil {
 		log.Printf("WARNING: Couldn't open %s, creating new deckbox", path)
-		blob = []byte(`[]`)
+		return Deckbox{Header: Header{SchemaVersion: currentSchemaVersion()}, Cards: []Card{}}, nil
 	}
 
+	defer file.Close()
+
+	return readDeckbox(file)
+}
+
+// Read every card from r and upgrade them to the current schema
+func readDeckbox(r io.Reader) (Deckbox, error) {
+	box, err := decodeDeckbox(r)
+
+	if err != nil {
+		return box, err
+	}
+
+	err = box.upgrade()
+	return box, err
+}
+
+// Read every card from r as stored, without upgrading them
+func decodeDeckbox(r io.Reader) (Deckbox, error) {
 	var box Deckbox
 
-	err = json.Unmarshal(blob, &box)
+	cr, err := NewCardReader(r)
 
 	if err != nil {
 		return box, err
 	}
 
+	box.Cards = []Card{}
+
+	for {
+		card, err := cr.Next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return box, err
+		}
+
+		if cr.Array() {
+			box.Cards = append(box.Cards, card)
+		} else {
+			// Each line is a newer copy of the card than the ones before
+			box.merge(card, true)
+		}
+	}
+
+	box.Header = cr.Header()
+	box.reindex()
 	return box, nil
 }
 
-func processSearchResults(seenCards map[string]bool, pageChan chan int, multiverseChan chan int) {
+func writeIdMap(path string, changes map[string]string) error {
+	blob, err := json.MarshalIndent(changes, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, blob, 0644)
+}
+
+// The cards and printings already in the database. Search results that
+// match both are skipped instead of fetched again.
+type Seen struct {
+	Names         map[string]bool
+	MultiverseIds map[int]bool
+}
+
+func newSeen(box *Deckbox) Seen {
+	seen := Seen{Names: map[string]bool{}, MultiverseIds: box.MultiverseSet()}
+
+	for _, card := range box.Cards {
+		seen.Names[normalizeName(card.Name)] = true
+	}
+
+	return seen
+}
+
+// A search result is known if we have its printing and a card with its
+// name. Split cards are listed under both halves, e.g. "Stand // Deliver".
+func (s Seen) Known(result SearchResult) bool {
+	if !s.MultiverseIds[result.MultiverseId] {
+		return false
+	}
+
+	for _, name := range strings.Split(result.Name, "//") {
+		if !s.Names[normalizeName(name)] {
+			return false
+		}
+	}
+
+	return true
+}
+
+type CrawlStats struct {
+	Skipped int64
+	Fetched int64
+	Failed  int64
+	Added   int64
+	Updated int64
+}
+
+func (s *CrawlStats) String() string {
+	return fmt.Sprintf("%d skipped, %d fetched, %d failed, %d cards added, %d cards updated",
+		atomic.LoadInt64(&s.Skipped), atomic.LoadInt64(&s.Fetched), atomic.LoadInt64(&s.Failed),
+		atomic.LoadInt64(&s.Added), atomic.LoadInt64(&s.Updated))
+}
+
+func processSearchResults(seen Seen, pageChan chan int, multiverseChan chan int, stats *CrawlStats) {
 	var fetchGroup sync.WaitGroup
 
 	log.Printf("Determining total number of pages")
@@ -165,10 +355,13 @@ func processSearchResults(seenCards map[string]bool, pageChan chan int, multiver
 
 				for _, result := range results {
 
-					if !seenCards[result.Id] {
-						toProcess += 1
-						multiverseChan <- result.MultiverseId
+					if seen.Known(result) {
+						atomic.AddInt64(&stats.Skipped, 1)
+						continue
 					}
+
+					toProcess += 1
+					multiverseChan <- result.MultiverseId
 				}
 
 				log.Printf("Found %d total cards on page %d, %d new", len(results), page, toProcess)
@@ -183,7 +376,7 @@ func processSearchResults(seenCards map[string]bool, pageChan chan int, multiver
 	}()
 }
 
-func processCards(multiverseChan chan int, cardChan chan Card) {
+func processCards(multiverseChan chan int, cardChan chan Card, stats *CrawlStats) {
 	// Start N go routines to go fetch and parse cards
 	var parseGroup sync.WaitGroup
 
@@ -205,9 +398,12 @@ func processCards(multiverseChan chan int, cardChan chan Card) {
 
 				if err != nil {
 					log.Printf("ERROR Couldn't parse %d: %s", id, err)
+					atomic.AddInt64(&stats.Failed, 1)
 					continue
 				}
 
+				atomic.AddInt64(&stats.Fetched, 1)
+
 				for _, card := range cards {
 
 					if card.Name == "" {
@@ -229,15 +425,17 @@ func processCards(multiverseChan chan int, cardChan chan Card) {
 
 // One go rotine pulls cards off the channel, adds them to the database
 // And flushes it to memory
-func saveCards(path string, box *Deckbox, cardChan chan Card) {
+func saveCards(store Store, box *Deckbox, cardChan chan Card, stats *CrawlStats) {
 	count := 0
+	changed := map[string]bool{}
+
 	for {
 		card, ok := <-cardChan
 
 		if !ok {
 			log.Printf("FINISHED")
-			sort.Sort(box)
-			err := box.Flush(path)
+			box.Sort()
+			err := store.Flush(box)
 
 			if err != nil {
 				log.Fatal(err)
@@ -246,28 +444,54 @@ func saveCards(path string, box *Deckbox, cardChan chan Card) {
 			return
 		}
 
-		err := box.Add(card)
+		before, known := box.ById(card.Id)
+		err := box.Refresh(card)
 
 		if err != nil {
 			log.Printf("ERROR Couldn't add card to database %s", card.Name)
 			continue
 		}
 
+		// A card that's already known only counts as updated if merging
+		// changed it
+		if after, _ := box.ById(card.Id); !known {
+			atomic.AddInt64(&stats.Added, 1)
+		} else if reflect.DeepEqual(before, after) {
+			continue
+		} else {
+			atomic.AddInt64(&stats.Updated, 1)
+		}
+
+		changed[card.Id] = true
 		count += 1
 
 		if count >= 1000 {
 			log.Printf("Added 1000 cards to the database")
 
-			err := box.Flush(path)
+			err := store.Update(box, changedCards(box, changed))
 
 			if err != nil {
 				log.Fatal(err)
 			}
 			count = 0
+			changed = map[string]bool{}
 		}
 	}
 }
 
+// Look up the current version of every changed card
+func changedCards(box *Deckbox, changed map[string]bool) []Card {
+	cards := []Card{}
+
+	for id := range changed {
+		if card, found := box.ById(id); found {
+			cards = append(cards, card)
+		}
+	}
+
+	return cards
+}
+
 func findEmptyEditions(box *Deckbox, multiverseChan chan int) {
 	log.Printf("%d", len(box.Cards))
 	count := 0
@@ -285,7 +509,7 @@ func findEmptyEditions(box *Deckbox, multiverseChan chan int) {
 	close(multiverseChan)
 }
 
-func processEditions(multiverseChan chan int, cardChan chan Card) {
+func processEditions(multiverseChan chan int, cardChan chan Card, stats *CrawlStats) {
 	// Start N go routines to go fetch and parse cards
 	var parseGroup sync.WaitGroup
 
@@ -307,9 +531,12 @@ func processEditions(multiverseChan chan int, cardChan chan Card) {
 
 				if err != nil {
 					log.Printf("ERROR Couldn't parse %d: %s", id, err)
+					atomic.AddInt64(&stats.Failed, 1)
 					continue
 				}
 
+				atomic.AddInt64(&stats.Fetched, 1)
+
 				for _, card := range cards {
 
 					if card.Name == "" {
@@ -335,32 +562,155 @@ func saveEditions(path string, box Deckbox, editionChan chan Card) {
 	}
 }
 
+// Write the deckbox to a different file, e.g. a SQLite database
+func exportDeckbox(box *Deckbox, path string) error {
+	store, err := openStore(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer store.Close()
+
+	box.Sort()
+	return store.Flush(box)
+}
+
 func main() {
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
+	if len(os.Args) > 1 {
+		if command, found := commands[os.Args[1]]; found {
+			err := command(os.Args[2:])
+
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			return
+		}
+	}
+
+	flag.Usage = func() {
+		usage()
+		flag.PrintDefaults()
+	}
+
+	symbolPath := flag.String("symbols", "", "JSON file with extra mana symbols")
+	idMapPath := flag.String("idmap", "", "Write a JSON map of migrated card ids to this file")
+	compact := flag.Bool("compact", false, "Compact a JSON Lines database and exit")
+	backups := flag.Int("backups", 0, "Number of old copies of the database to keep")
+	pretty := flag.Bool("pretty", false, "Pretty print the JSON database")
+
 	flag.Parse()
 
 	path := flag.Arg(0)
 
-	box, err := loadDeckBox(path)
+	if *pretty {
+		flushOptions.Indent = "  "
+	}
+
+	if *symbolPath != "" {
+		file, err := os.Open(*symbolPath)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = symbols.Load(file)
+		file.Close()
+
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Once per run, before anything is written
+	if *backups > 0 {
+		err := rotateBackups(path, *backups)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *compact {
+		err := CompactLines(path)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	store, err := openStore(path)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer store.Close()
+
+	box, err := store.Load()
 
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if box.Header.SchemaVersion < currentSchemaVersion() {
+		for _, m := range migrations {
+			if m.Version > box.Header.SchemaVersion {
+				log.Printf("Upgraded cards to schema version %d: %s", m.Version, m.Description)
+			}
+		}
+
+		if changes := box.migratedIds; len(changes) > 0 {
+			log.Printf("Migrated %d card ids to the current id scheme", len(changes))
+
+			if *idMapPath != "" {
+				err := writeIdMap(*idMapPath, changes)
+
+				if err != nil {
+					log.Fatal(err)
+				}
+			}
+		}
+
+		// Rewrite the store before anything is appended in the new format
+		err := store.Flush(&box)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	box.Header.GeneratedAt = time.Now().UTC().Format(time.RFC3339)
+	box.Header.Source = "http://gatherer.wizards.com"
+
 	cardChannel := make(chan Card)
 	editionChannel := make(chan Card)
 	multiverseCardChannel := make(chan int, 15000)
 	multiverseEditionChannel := make(chan int, 15000)
 	pageChannel := make(chan int, 200)
 
+	stats := &CrawlStats{}
+
 	// Fetch all the cards
-	go processSearchResults(box.IdSet(), pageChannel, multiverseCardChannel)
-	go processCards(multiverseCardChannel, cardChannel)
-	saveCards(path, &box, cardChannel)
+	go processSearchResults(newSeen(&box), pageChannel, multiverseCardChannel, stats)
+	go processCards(multiverseCardChannel, cardChannel, stats)
+	saveCards(store, &box, cardChannel, stats)
+
+	log.Printf("Cards: %s", stats)
+
+	stats = &CrawlStats{}
 
 	// Fetch all the editions
 	go findEmptyEditions(&box, multiverseEditionChannel)
-	go processEditions(multiverseEditionChannel, editionChannel)
-	saveCards(path, &box, editionChannel)
+	go processEditions(multiverseEditionChannel, editionChannel, stats)
+	saveCards(store, &box, editionChannel, stats)
+
+	log.Printf("Editions: %s", stats)
+
+	symbols.Report()
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
     "os"
 	"io/ioutil"
+	"path/filepath"
 	"testing"
 )
 
@@ -85,3 +86,56 @@ func TestDeckboxJSON(t *testing.T) {
 		t.Fatalf("Loaded an empty card??")
 	}
 }
+
+func TestSeenKnown(t *testing.T) {
+	box := Deckbox{Cards: []Card{
+		Card{Name: "Æthersnipe", Editions: []Edition{Edition{MultiverseId: 189211}}},
+		Card{Name: "Stand", Editions: []Edition{Edition{MultiverseId: 20574}}},
+		Card{Name: "Deliver", Editions: []Edition{Edition{MultiverseId: 20574}}},
+	}}
+
+	seen := newSeen(&box)
+
+	tests := []struct {
+		result SearchResult
+		known  bool
+	}{
+		{SearchResult{Name: "Aethersnipe", MultiverseId: 189211}, true},
+		{SearchResult{Name: "Æthersnipe", MultiverseId: 145817}, false},
+		{SearchResult{Name: "Stand // Deliver", MultiverseId: 20574}, true},
+		{SearchResult{Name: "Elspeth Tirel", MultiverseId: 189211}, false},
+	}
+
+	for _, test := range tests {
+		if seen.Known(test.result) != test.known {
+			t.Errorf("%+v should be known: %v", test.result, test.known)
+		}
+	}
+}
+
+func TestSaveCardsStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frantic")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	box := Deckbox{Cards: []Card{Card{Id: "f", Editions: []Edition{Edition{MultiverseId: 1}}}}}
+	cardChan := make(chan Card, 5)
+	stats := &CrawlStats{}
+
+	cardChan <- Card{Id: "f", Editions: []Edition{Edition{MultiverseId: 2}}}
+	cardChan <- Card{Id: "g", Editions: []Edition{Edition{MultiverseId: 3}}}
+	cardChan <- Card{Id: "g", Editions: []Edition{Edition{MultiverseId: 4}}}
+	cardChan <- Card{Id: "f", Editions: []Edition{Edition{MultiverseId: 1}}}
+	cardChan <- Card{Id: "g", Editions: []Edition{Edition{MultiverseId: 3}}}
+	close(cardChan)
+
+	saveCards(JSONStore{Path: filepath.Join(dir, "cards.json")}, &box, cardChan, stats)
+
+	if stats.Added != 1 || stats.Updated != 2 {
+		t.Errorf("Expected 1 card added and 2 updated, got %s", stats)
+	}
+}
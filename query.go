@@ -0,0 +1,846 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A small query language in the style of Gatherer's advanced search:
+//
+//	t:creature c:rg cmc<=3 (o:haste or o:trample) -s:alpha
+//
+// Terms next to each other must all match. "or" binds looser than that, and
+// "-" or "not" negates a term. A bare word or "quoted phrase" searches names.
+
+// A Query is a node of the parsed syntax tree
+type Query interface {
+	Match(card Card) bool
+	String() string
+}
+
+type AndQuery struct {
+	Terms []Query
+}
+
+type OrQuery struct {
+	Terms []Query
+}
+
+type NotQuery struct {
+	Term Query
+}
+
+// A single field comparison, e.g. cmc>=3
+type Condition struct {
+	Field string
+	Op    string
+	Value string
+	match func(card Card) bool
+}
+
+func (q AndQuery) Match(card Card) bool {
+	for _, term := range q.Terms {
+		if !term.Match(card) {
+			return false
+		}
+	}
+	return true
+}
+
+func (q OrQuery) Match(card Card) bool {
+	for _, term := range q.Terms {
+		if term.Match(card) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q NotQuery) Match(card Card) bool {
+	return !q.Term.Match(card)
+}
+
+func (c Condition) Match(card Card) bool {
+	return c.match(card)
+}
+
+func (q AndQuery) String() string {
+	return "(" + joinQueries(q.Terms, " and ") + ")"
+}
+
+func (q OrQuery) String() string {
+	return "(" + joinQueries(q.Terms, " or ") + ")"
+}
+
+func (q NotQuery) String() string {
+	return "-" + q.Term.String()
+}
+
+func (c Condition) String() string {
+	return c.Field + c.Op + strconv.Quote(c.Value)
+}
+
+func joinQueries(terms []Query, sep string) string {
+	parts := []string{}
+
+	for _, term := range terms {
+		parts = append(parts, term.String())
+	}
+
+	return strings.Join(parts, sep)
+}
+
+type queryField struct {
+	names []string
+	kind  fieldKind
+	// Whether ":" matches whole values instead of substrings
+	exact bool
+	// Abbreviations for values, e.g. r:m for mythic
+	aliases map[string]string
+	// The card's values for text fields, or its value for numeric ones
+	text    func(card Card) []string
+	numeric func(card Card) (float64, bool)
+}
+
+type fieldKind int
+
+const (
+	textField fieldKind = iota
+	numericField
+	colorField
+)
+
+var queryFields = []queryField{
+	{names: []string{"name", "n"}, kind: textField, text: func(c Card) []string {
+		return []string{c.Name}
+	}},
+	{names: []string{"type", "t"}, kind: textField, exact: true, text: func(c Card) []string {
+		return append(append([]string{}, c.Types...), c.Subtypes...)
+	}},
+	{names: []string{"subtype", "st"}, kind: textField, exact: true, text: func(c Card) []string {
+		return c.Subtypes
+	}},
+	{names: []string{"text", "o"}, kind: textField, text: func(c Card) []string {
+		return []string{strings.Join(c.RulesText, "\n")}
+	}},
+	{names: []string{"mana", "m"}, kind: textField, text: func(c Card) []string {
+		return []string{c.ManaCost}
+	}},
+	{names: []string{"cmc"}, kind: numericField, numeric: func(c Card) (float64, bool) {
+		return c.ConvertedCost, true
+	}},
+	{names: []string{"color", "c"}, kind: colorField},
+	{names: []string{"rarity", "r"}, kind: textField, exact: true, aliases: rarities, text: func(c Card) []string {
+		return editionValues(c, func(e Edition) string { return e.Rarity })
+	}},
+	{names: []string{"set", "s", "e"}, kind: textField, text: func(c Card) []string {
+		return editionValues(c, func(e Edition) string { return e.Set })
+	}},
+	{names: []string{"artist", "a"}, kind: textField, text: func(c Card) []string {
+		return editionValues(c, func(e Edition) string { return e.Artist })
+	}},
+	{names: []string{"power", "pow"}, kind: numericField, numeric: func(c Card) (float64, bool) {
+		return parseStat(c.Power)
+	}},
+	{names: []string{"toughness", "tou"}, kind: numericField, numeric: func(c Card) (float64, bool) {
+		return parseStat(c.Toughness)
+	}},
+	{names: []string{"loyalty", "loy"}, kind: numericField, numeric: func(c Card) (float64, bool) {
+		return float64(c.Loyalty), c.Loyalty != 0
+	}},
+}
+
+func findField(name string) (queryField, bool) {
+	for _, f := range queryFields {
+		if contains(f.names, name) {
+			return f, true
+		}
+	}
+	return queryField{}, false
+}
+
+func editionValues(card Card, value func(Edition) string) []string {
+	values := []string{}
+
+	for _, e := range card.Editions {
+		if v := value(e); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
+
+// Power and toughness like * or 1+* aren't numbers
+func parseStat(stat string) (float64, bool) {
+	n, err := strconv.ParseFloat(stat, 64)
+	return n, err == nil
+}
+
+var rarities = map[string]string{
+	"c": "common",
+	"u": "uncommon",
+	"r": "rare",
+	"m": "mythic",
+}
+
+var colorLetters = map[rune]string{
+	'w': "white",
+	'u': "blue",
+	'b': "black",
+	'r': "red",
+	'g': "green",
+}
+
+// The card's colors from its mana cost and color indicator
+func cardColors(card Card) map[string]bool {
+	colors := map[string]bool{}
+	parsed, _ := symbols.Parse(card.ManaCost)
+
+	for _, s := range parsed {
+		for _, color := range s.Colors {
+			colors[color] = true
+		}
+	}
+
+	for _, color := range card.ColorIndicator {
+		colors[color] = true
+	}
+
+	return colors
+}
+
+// The card's colors plus the colors of any mana symbols in its rules text,
+// leaving out reminder text
+func colorIdentity(card Card) map[string]bool {
+	colors := cardColors(card)
+
+	for _, p := range card.RulesText {
+		p = reminderTextPattern.ReplaceAllString(p, "")
+
+		for _, symbol := range manaSymbolPattern.FindAllString(p, -1) {
+			if s, found := symbols.Symbol(symbol); found {
+				for _, color := range s.Colors {
+					colors[color] = true
+				}
+			}
+		}
+	}
+
+	return colors
+}
+
+var (
+	manaSymbolPattern   = regexp.MustCompile(`\{[^{}]+\}`)
+	reminderTextPattern = regexp.MustCompile(`\([^()]*\)`)
+)
+
+// Colors as upper case letters in WUBRG order, e.g. ["U", "R"]
+func colorCodes(colors map[string]bool) []string {
+	codes := []string{}
+
+	for _, letter := range "wubrg" {
+		if colors[colorLetters[letter]] {
+			codes = append(codes, strings.ToUpper(string(letter)))
+		}
+	}
+
+	return codes
+}
+
+// Parse a color value like "rg", "red" or "colorless"
+func parseColors(value string) (map[string]bool, error) {
+	colors := map[string]bool{}
+
+	switch value {
+	case "c", "colorless":
+		return colors, nil
+	case "white", "blue", "black", "red", "green":
+		colors[value] = true
+		return colors, nil
+	}
+
+	for _, letter := range value {
+		color, found := colorLetters[letter]
+
+		if !found {
+			return nil, fmt.Errorf("unknown color %q", value)
+		}
+
+		colors[color] = true
+	}
+
+	return colors, nil
+}
+
+func newCondition(name, op, value string) (Condition, error) {
+	field, found := findField(name)
+
+	if !found {
+		return Condition{}, fmt.Errorf("unknown field %s", name)
+	}
+
+	c := Condition{Field: field.names[0], Op: op, Value: value}
+	value = strings.ToLower(value)
+
+	switch field.kind {
+	case textField:
+		if op != ":" && op != "=" && op != "!=" {
+			return c, fmt.Errorf("%s can't be compared with %s", c.Field, op)
+		}
+
+		normalize := strings.ToLower
+
+		if c.Field == "name" {
+			normalize = normalizeName
+		}
+
+		value = normalize(value)
+
+		if alias, found := field.aliases[value]; found {
+			value = alias
+		}
+
+		substring := op == ":" && !field.exact
+
+		c.match = func(card Card) bool {
+			matched := false
+
+			for _, v := range field.text(card) {
+				v = normalize(v)
+
+				if (substring && strings.Contains(v, value)) || (!substring && v == value) {
+					matched = true
+					break
+				}
+			}
+
+			return matched == (op != "!=")
+		}
+	case numericField:
+		n, err := strconv.ParseFloat(value, 64)
+
+		if err != nil {
+			// Stats like * can only be matched exactly
+			if (c.Field != "power" && c.Field != "toughness") || (op != ":" && op != "=") {
+				return c, fmt.Errorf("%s should be compared with a number, not %q", c.Field, c.Value)
+			}
+
+			stat := map[string]func(Card) string{
+				"power":     func(card Card) string { return card.Power },
+				"toughness": func(card Card) string { return card.Toughness },
+			}[c.Field]
+
+			c.match = func(card Card) bool {
+				return stat(card) == value
+			}
+
+			return c, nil
+		}
+
+		c.match = func(card Card) bool {
+			v, ok := field.numeric(card)
+			return ok && compareNumbers(v, op, n)
+		}
+	case colorField:
+		if value == "m" || value == "multicolor" {
+			if op != ":" {
+				return c, fmt.Errorf("multicolor can only be used with :")
+			}
+
+			c.match = func(card Card) bool {
+				return len(cardColors(card)) > 1
+			}
+
+			return c, nil
+		}
+
+		want, err := parseColors(value)
+
+		if err != nil {
+			return c, err
+		}
+
+		c.match = func(card Card) bool {
+			return compareColors(cardColors(card), op, want)
+		}
+	}
+
+	return c, nil
+}
+
+func compareNumbers(a float64, op string, b float64) bool {
+	switch op {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	case "!=":
+		return a != b
+	}
+	return a == b
+}
+
+// ":" and ">=" mean the card has at least these colors, "<=" at most, and
+// "=" exactly. Searching for colorless with ":" means exactly colorless.
+func compareColors(have map[string]bool, op string, want map[string]bool) bool {
+	subset := func(a, b map[string]bool) bool {
+		for color := range a {
+			if !b[color] {
+				return false
+			}
+		}
+		return true
+	}
+
+	if op == ":" && len(want) == 0 {
+		op = "="
+	}
+
+	switch op {
+	case ":", ">=":
+		return subset(want, have)
+	case ">":
+		return subset(want, have) && len(have) > len(want)
+	case "<=":
+		return subset(have, want)
+	case "<":
+		return subset(have, want) && len(have) < len(want)
+	case "!=":
+		return !(subset(want, have) && subset(have, want))
+	}
+	return subset(want, have) && subset(have, want)
+}
+
+type tokenKind int
+
+const (
+	tokenTerm tokenKind = iota
+	tokenOpen
+	tokenClose
+	tokenNot
+	tokenAnd
+	tokenOr
+)
+
+type token struct {
+	kind  tokenKind
+	field string
+	op    string
+	value string
+	pos   int
+}
+
+var queryOps = []string{"<=", ">=", "!=", ":", "=", "<", ">"}
+
+func lexQuery(input string) ([]token, error) {
+	tokens := []token{}
+	runes := []rune(input)
+	i := 0
+
+	for i < len(runes) {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i += 1
+			continue
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenOpen, pos: i})
+			i += 1
+			continue
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenClose, pos: i})
+			i += 1
+			continue
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]):
+			tokens = append(tokens, token{kind: tokenNot, pos: i})
+			i += 1
+			continue
+		}
+
+		start := i
+		t := token{kind: tokenTerm, pos: start}
+
+		// A field name is letters followed by an operator
+		j := i
+
+		for j < len(runes) && unicode.IsLetter(runes[j]) {
+			j += 1
+		}
+
+		if j > i {
+			rest := string(runes[j:])
+
+			for _, op := range queryOps {
+				if strings.HasPrefix(rest, op) {
+					t.field = strings.ToLower(string(runes[i:j]))
+					t.op = op
+					i = j + len([]rune(op))
+					break
+				}
+			}
+		}
+
+		value, next, err := lexValue(runes, i)
+
+		if err != nil {
+			return nil, err
+		}
+
+		t.value = value
+		i = next
+
+		if t.field == "" && value == "" {
+			return nil, fmt.Errorf("unexpected %q at position %d", string(runes[start]), start)
+		}
+
+		if t.field != "" && value == "" {
+			return nil, fmt.Errorf("%s%s needs a value at position %d", t.field, t.op, start)
+		}
+
+		if t.field == "" && runes[start] != '"' {
+			switch strings.ToLower(value) {
+			case "and":
+				t.kind = tokenAnd
+			case "or":
+				t.kind = tokenOr
+			case "not":
+				t.kind = tokenNot
+			}
+		}
+
+		tokens = append(tokens, t)
+	}
+
+	return tokens, nil
+}
+
+// Read a quoted phrase, or a word up to whitespace or a parenthesis
+func lexValue(runes []rune, i int) (string, int, error) {
+	if i < len(runes) && runes[i] == '"' {
+		end := i + 1
+
+		for end < len(runes) && runes[end] != '"' {
+			end += 1
+		}
+
+		if end == len(runes) {
+			return "", end, fmt.Errorf("unterminated quote at position %d", i)
+		}
+
+		return string(runes[i+1 : end]), end + 1, nil
+	}
+
+	end := i
+
+	for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != '(' && runes[end] != ')' {
+		end += 1
+	}
+
+	return string(runes[i:end]), end, nil
+}
+
+type queryParser struct {
+	tokens []token
+	pos    int
+}
+
+func ParseQuery(input string) (Query, error) {
+	tokens, err := lexQuery(input)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+
+	p := &queryParser{tokens: tokens}
+	q, err := p.parseOr()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if t, ok := p.peek(); ok {
+		return nil, fmt.Errorf("unexpected %s at position %d", describeToken(t), t.pos)
+	}
+
+	return q, nil
+}
+
+func (p *queryParser) peek() (token, bool) {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos], true
+	}
+	return token{}, false
+}
+
+func (p *queryParser) parseOr() (Query, error) {
+	terms := []Query{}
+
+	for {
+		q, err := p.parseAnd()
+
+		if err != nil {
+			return nil, err
+		}
+
+		terms = append(terms, q)
+
+		if t, ok := p.peek(); !ok || t.kind != tokenOr {
+			break
+		}
+
+		p.pos += 1
+	}
+
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+
+	return OrQuery{Terms: terms}, nil
+}
+
+func (p *queryParser) parseAnd() (Query, error) {
+	terms := []Query{}
+
+	for {
+		t, ok := p.peek()
+
+		if !ok || t.kind == tokenOr || t.kind == tokenClose {
+			break
+		}
+
+		if t.kind == tokenAnd {
+			if len(terms) == 0 {
+				return nil, fmt.Errorf("unexpected and at position %d", t.pos)
+			}
+			p.pos += 1
+		}
+
+		q, err := p.parseUnary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		terms = append(terms, q)
+	}
+
+	switch len(terms) {
+	case 0:
+		if t, ok := p.peek(); ok {
+			return nil, fmt.Errorf("unexpected %s at position %d", describeToken(t), t.pos)
+		}
+		return nil, fmt.Errorf("query ends too soon")
+	case 1:
+		return terms[0], nil
+	}
+
+	return AndQuery{Terms: terms}, nil
+}
+
+func (p *queryParser) parseUnary() (Query, error) {
+	t, ok := p.peek()
+
+	if !ok {
+		return nil, fmt.Errorf("query ends too soon")
+	}
+
+	p.pos += 1
+
+	switch t.kind {
+	case tokenNot:
+		q, err := p.parseUnary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return NotQuery{Term: q}, nil
+	case tokenOpen:
+		q, err := p.parseOr()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if next, ok := p.peek(); !ok || next.kind != tokenClose {
+			return nil, fmt.Errorf("missing ) for ( at position %d", t.pos)
+		}
+
+		p.pos += 1
+		return q, nil
+	case tokenTerm:
+		if t.field == "" {
+			return newCondition("name", ":", t.value)
+		}
+		return newCondition(t.field, t.op, t.value)
+	}
+
+	return nil, fmt.Errorf("unexpected %s at position %d", describeToken(t), t.pos)
+}
+
+func describeToken(t token) string {
+	switch t.kind {
+	case tokenOpen:
+		return "("
+	case tokenClose:
+		return ")"
+	case tokenNot:
+		return "not"
+	case tokenAnd:
+		return "and"
+	case tokenOr:
+		return "or"
+	}
+	return strconv.Quote(t.field + t.op + t.value)
+}
+
+// Return every card matching the query, in the deckbox's order
+func (d *Deckbox) Search(q Query) []Card {
+	matches := []Card{}
+
+	for _, card := range d.Cards {
+		if q.Match(card) {
+			matches = append(matches, card)
+		}
+	}
+
+	return matches
+}
+
+// frantic search [-db cards.json] [-json] [-limit n] [-text "full text"] query ...
+func searchCommand(args []string) error {
+	flags := flag.NewFlagSet("search", flag.ExitOnError)
+	dbPath := flags.String("db", "cards.json", "The database to search")
+	asJSON := flags.Bool("json", false, "Print matching cards as JSON")
+	limit := flags.Int("limit", 0, "Print at most this many cards")
+	text := flags.String("text", "", "Rank cards by a full-text search of rules and flavor text")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 && *text == "" {
+		return fmt.Errorf("usage: search [-db cards.json] [-json] [-limit n] [-text \"full text\"] query ...\nfields: %s",
+			strings.Join(queryFieldNames(), ", "))
+	}
+
+	var q Query = AndQuery{}
+
+	if flags.NArg() > 0 {
+		var err error
+		q, err = ParseQuery(strings.Join(flags.Args(), " "))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	matches := []Card{}
+	scores := []float64{}
+
+	if *text != "" {
+		box, err := openDeckbox(*dbPath)
+
+		if err != nil {
+			return err
+		}
+
+		box.Sort()
+		ranked, err := openTextIndex(&box, *dbPath).Search(*text)
+
+		if err != nil {
+			return err
+		}
+
+		for _, m := range ranked {
+			if card, found := box.ById(m.Id); found && q.Match(card) {
+				matches = append(matches, card)
+				scores = append(scores, m.Score)
+			}
+		}
+	} else {
+		// Only the matches are kept, so a search doesn't need the whole
+		// database in memory
+		err := StreamCards(*dbPath, func(card Card) bool {
+			if q.Match(card) {
+				matches = append(matches, card)
+			}
+			return *limit == 0 || len(matches) < *limit
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if *limit > 0 && len(matches) > *limit {
+		matches = matches[:*limit]
+	}
+
+	if *asJSON {
+		blob, err := json.MarshalIndent(matches, "", "  ")
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(blob))
+		return nil
+	}
+
+	for i, card := range matches {
+		if len(scores) > 0 {
+			fmt.Printf("%6.2f  %s\n", scores[i], formatCardLine(card))
+		} else {
+			fmt.Println(formatCardLine(card))
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%d cards\n", len(matches))
+	return nil
+}
+
+// One line per card: name, mana cost, type line and power/toughness
+func formatCardLine(card Card) string {
+	parts := []string{card.Name}
+
+	if card.ManaCost != "" {
+		parts = append(parts, card.ManaCost)
+	}
+
+	parts = append(parts, card.TypeLine())
+
+	if card.Power != "" || card.Toughness != "" {
+		parts = append(parts, card.Power+"/"+card.Toughness)
+	} else if card.Loyalty != 0 {
+		parts = append(parts, strconv.Itoa(card.Loyalty))
+	}
+
+	return strings.Join(parts, "  ")
+}
+
+// The fields a query can use, for usage messages
+func queryFieldNames() []string {
+	names := []string{}
+
+	for _, f := range queryFields {
+		names = append(names, strings.Join(f.names, "/"))
+	}
+
+	sort.Strings(names)
+	return names
+}
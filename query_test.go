@@ -0,0 +1,136 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := map[string]string{
+		"goblin":                           `name:"goblin"`,
+		`"lord of"`:                        `name:"lord of"`,
+		"t:creature c:rg":                  `(type:"creature" and color:"rg")`,
+		"t:creature and cmc<=3":            `(type:"creature" and cmc<="3")`,
+		"o:haste or o:trample":             `(text:"haste" or text:"trample")`,
+		"t:elf (o:haste or pow>=3) -s:lea": `(type:"elf" and (text:"haste" or power>="3") and -set:"lea")`,
+		"not r:m a:\"rk post\"":            `(-rarity:"m" and artist:"rk post")`,
+		"a or b c":                         `(name:"a" or (name:"b" and name:"c"))`,
+	}
+
+	for input, expected := range tests {
+		q, err := ParseQuery(input)
+
+		if err != nil {
+			t.Errorf("%s: %s", input, err)
+			continue
+		}
+
+		if q.String() != expected {
+			t.Errorf("%s parsed as %s, not %s", input, q, expected)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"foo:bar",
+		"cmc>three",
+		"t>creature",
+		"c:purple",
+		"(t:elf",
+		"t:elf)",
+		"o:\"unterminated",
+		"or t:elf",
+		"t:",
+	} {
+		if _, err := ParseQuery(input); err == nil {
+			t.Errorf("%q should not parse", input)
+		}
+	}
+}
+
+func queryCards() []Card {
+	return []Card{
+		Card{
+			Name: "Huntmaster of the Fells", ManaCost: "{2}{R}{G}", ConvertedCost: 4,
+			Types: []string{"creature"}, Subtypes: []string{"human", "werewolf"},
+			RulesText: []string{"Whenever this creature enters the battlefield or transforms into Huntmaster of the Fells, put a 2/2 green Wolf creature token onto the battlefield and you gain 2 life."},
+			Power:     "2", Toughness: "2",
+			Editions: []Edition{Edition{Set: "Dark Ascension", Rarity: "mythic", Artist: "Chris Rahn"}},
+		},
+		Card{
+			Name: "Ravager of the Fells", ColorIndicator: []string{"red", "green"},
+			Types: []string{"creature"}, Subtypes: []string{"werewolf"},
+			RulesText: []string{"Trample"}, Power: "4", Toughness: "4",
+			Editions: []Edition{Edition{Set: "Dark Ascension", Rarity: "mythic", Artist: "Chris Rahn"}},
+		},
+		Card{
+			Name: "Elspeth Tirel", ManaCost: "{3}{W}{W}", ConvertedCost: 5,
+			Types: []string{"planeswalker"}, Subtypes: []string{"elspeth"}, Loyalty: 4,
+			Editions: []Edition{Edition{Set: "Scars of Mirrodin", Rarity: "mythic", Artist: "Michael Komarck"}},
+		},
+		Card{
+			Name: "Tarmogoyf", ManaCost: "{1}{G}", ConvertedCost: 2,
+			Types: []string{"creature"}, Subtypes: []string{"lhurgoyf"}, Power: "*", Toughness: "1+*",
+			Editions: []Edition{Edition{Set: "Future Sight", Rarity: "rare", Artist: "Justin Murray"}},
+		},
+		Card{
+			Name: "Ornithopter", ManaCost: "{0}", Types: []string{"artifact", "creature"},
+			Subtypes: []string{"thopter"}, RulesText: []string{"Flying"}, Power: "0", Toughness: "2",
+			Editions: []Edition{Edition{Set: "Antiquities", Rarity: "uncommon", Artist: "Amy Weber"}},
+		},
+	}
+}
+
+func TestSearch(t *testing.T) {
+	box := Deckbox{Cards: queryCards()}
+
+	tests := map[string][]string{
+		"fells":                      {"Huntmaster of the Fells", "Ravager of the Fells"},
+		"t:werewolf -o:trample":      {"Huntmaster of the Fells"},
+		"c:rg":                       {"Huntmaster of the Fells", "Ravager of the Fells"},
+		"c:c":                        {"Ornithopter"},
+		"c<=g":                       {"Tarmogoyf", "Ornithopter"},
+		"c:m":                        {"Huntmaster of the Fells", "Ravager of the Fells"},
+		"cmc>=4":                     {"Huntmaster of the Fells", "Elspeth Tirel"},
+		"pow>=2 tou<4":               {"Huntmaster of the Fells"},
+		"pow:*":                      {"Tarmogoyf"},
+		"r:m t:planeswalker loy=4":   {"Elspeth Tirel"},
+		"r:u or s:\"future sight\"":  {"Tarmogoyf", "Ornithopter"},
+		"a:rahn o:\"gain 2 life\"":   {"Huntmaster of the Fells"},
+		"m:{g} -(t:werewolf)":        {"Tarmogoyf"},
+		"t:artifact or st:elspeth":   {"Elspeth Tirel", "Ornithopter"},
+		"name=ornithopter":           {"Ornithopter"},
+		"n!=ornithopter t:thopter":   {},
+		"t:wolf":                     {},
+		"e:antiquities pow=0 o:fly":  {"Ornithopter"},
+		"(c:w or c:r) cmc!=4 -t:elf": {"Ravager of the Fells", "Elspeth Tirel"},
+	}
+
+	for input, expected := range tests {
+		q, err := ParseQuery(input)
+
+		if err != nil {
+			t.Errorf("%s: %s", input, err)
+			continue
+		}
+
+		names := []string{}
+
+		for _, card := range box.Search(q) {
+			names = append(names, card.Name)
+		}
+
+		if len(names) != len(expected) {
+			t.Errorf("%s matched %v, not %v", input, names, expected)
+			continue
+		}
+
+		for i := range names {
+			if names[i] != expected[i] {
+				t.Errorf("%s matched %v, not %v", input, names, expected)
+				break
+			}
+		}
+	}
+}
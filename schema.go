@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A JSON Schema for the files Flush writes, generated from the Go types so
+// it can't drift from them. Only the keywords the generator emits are
+// supported by the validator.
+
+const schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+type JSONSchema struct {
+	Schema      string `json:"$schema,omitempty"`
+	Id          string `json:"$id,omitempty"`
+	Ref         string `json:"$ref,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Either a single type or a list of them
+	Type                 interface{}            `json:"type,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Defs                 map[string]*JSONSchema `json:"$defs,omitempty"`
+}
+
+func minimum(n float64) *float64 {
+	return &n
+}
+
+const idPattern = "^[0-9a-f]{32}$"
+
+// What the Go types can't say, keyed by definition and property
+var schemaHints = map[string]JSONSchema{
+	"card.id": {
+		Description: "The MD5 of the card's normalized name",
+		Pattern:     idPattern,
+	},
+	"card.special": {
+		Description: "How the card shares its frame with its partner card",
+		Enum:        []string{"flip", "double-faced", "split"},
+	},
+	"card.partner_card": {
+		Description: "The id of the other half of a flip, double-faced or split card",
+		Pattern:     idPattern,
+	},
+	"card.side": {
+		Description: "a for the left half of a split card or the front face of a flip or double-faced card, b for the other",
+		Enum:        []string{"a", "b"},
+	},
+	"card.converted_cost": {Minimum: minimum(0)},
+	"card.color_indicator": {
+		Description: "Lower case color names",
+	},
+	"card.rules_text": {Description: "One entry per paragraph"},
+	"card.types":      {Description: "Lower case, e.g. creature or legendary"},
+	"card.subtypes":   {Description: "Lower case, e.g. human or werewolf"},
+	"edition.multiverse_id": {
+		Description: "Gatherer's id for the printing",
+		Minimum:     minimum(1),
+	},
+	"edition.flavor_text": {Description: "One entry per paragraph"},
+	"header.schema_version": {
+		Description: "The version of this format, see migrations.go",
+		Minimum:     minimum(0),
+	},
+	"header.generated_at": {Description: "When the crawl ran, in RFC 3339"},
+	"header.card_count":   {Minimum: minimum(0)},
+}
+
+// The named types, referenced from everywhere else
+var schemaDefs = map[reflect.Type]string{
+	reflect.TypeOf(Card{}):    "card",
+	reflect.TypeOf(Edition{}): "edition",
+	reflect.TypeOf(Header{}):  "header",
+}
+
+// Generate the schema for a file written by Flush
+func GenerateSchema() *JSONSchema {
+	root := structSchema(reflect.TypeOf(envelope{}), "envelope")
+	root.Schema = schemaDialect
+	root.Id = "https://github.com/kyleconroy/frantic-search/cards.schema.json"
+	root.Title = "Frantic Search cards"
+	root.Description = fmt.Sprintf("Magic cards crawled from Gatherer, schema version %d", currentSchemaVersion())
+	root.Defs = map[string]*JSONSchema{}
+
+	for t, name := range schemaDefs {
+		root.Defs[name] = structSchema(t, name)
+	}
+
+	return root
+}
+
+func structSchema(t reflect.Type, name string) *JSONSchema {
+	closed := false
+	schema := &JSONSchema{
+		Type:                 "object",
+		Properties:           map[string]*JSONSchema{},
+		Required:             []string{},
+		AdditionalProperties: &closed,
+	}
+
+	addFields(schema, t, name)
+	sort.Strings(schema.Required)
+	return schema
+}
+
+func addFields(schema *JSONSchema, t reflect.Type, name string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		if f.Anonymous {
+			embedded := name
+
+			if def, found := schemaDefs[f.Type]; found {
+				embedded = def
+			}
+
+			addFields(schema, f.Type, embedded)
+			continue
+		}
+
+		tag := strings.Split(f.Tag.Get("json"), ",")
+		key := tag[0]
+
+		if f.PkgPath != "" || key == "-" {
+			continue
+		}
+
+		if key == "" {
+			key = f.Name
+		}
+
+		omitEmpty := len(tag) > 1 && tag[1] == "omitempty"
+		property := typeSchema(f.Type)
+
+		// Go writes nil slices as null
+		if f.Type.Kind() == reflect.Slice && !omitEmpty {
+			property.Type = []string{"array", "null"}
+		}
+
+		if hint, found := schemaHints[name+"."+key]; found {
+			property.Description = hint.Description
+			property.Enum = hint.Enum
+			property.Pattern = hint.Pattern
+			property.Minimum = hint.Minimum
+		}
+
+		schema.Properties[key] = property
+
+		if !omitEmpty {
+			schema.Required = append(schema.Required, key)
+		}
+	}
+}
+
+func typeSchema(t reflect.Type) *JSONSchema {
+	if name, found := schemaDefs[t]; found {
+		return &JSONSchema{Ref: "#/$defs/" + name}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Int, reflect.Int64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Slice:
+		return &JSONSchema{Type: "array", Items: typeSchema(t.Elem())}
+	}
+
+	panic(fmt.Sprintf("no JSON Schema for %s", t))
+}
+
+// Check a decoded JSON document against the schema. The document must be
+// decoded with UseNumber so integers can be told apart.
+func (s *JSONSchema) Validate(doc interface{}) []Violation {
+	return s.validate(s, doc, "")
+}
+
+func (s *JSONSchema) validate(root *JSONSchema, doc interface{}, path string) []Violation {
+	if s.Ref != "" {
+		def, found := root.Defs[strings.TrimPrefix(s.Ref, "#/$defs/")]
+
+		if !found {
+			return []Violation{schemaViolation(path, "unknown reference %s", s.Ref)}
+		}
+
+		return def.validate(root, doc, path)
+	}
+
+	if types := schemaTypes(s.Type); len(types) > 0 && !contains(types, jsonType(doc)) {
+		// Every integer is also a number
+		if !(jsonType(doc) == "integer" && contains(types, "number")) {
+			return []Violation{schemaViolation(path, "should be %s, not %s", strings.Join(types, " or "), jsonType(doc))}
+		}
+	}
+
+	violations := []Violation{}
+
+	switch value := doc.(type) {
+	case map[string]interface{}:
+		for _, key := range s.Required {
+			if _, found := value[key]; !found {
+				violations = append(violations, schemaViolation(path, "%s is required", key))
+			}
+		}
+
+		keys := []string{}
+
+		for key := range value {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			property, found := s.Properties[key]
+
+			if !found {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					violations = append(violations, schemaViolation(path, "unexpected property %s", key))
+				}
+				continue
+			}
+
+			violations = append(violations, property.validate(root, value[key], joinPath(path, key))...)
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range value {
+				violations = append(violations, s.Items.validate(root, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case string:
+		if len(s.Enum) > 0 && !contains(s.Enum, value) {
+			violations = append(violations, schemaViolation(path, "%q should be one of %s", value, strings.Join(s.Enum, ", ")))
+		}
+
+		if s.Pattern == "" {
+			break
+		}
+
+		if re, err := regexp.Compile(s.Pattern); err != nil {
+			violations = append(violations, schemaViolation(path, "bad pattern %s: %s", s.Pattern, err))
+		} else if !re.MatchString(value) {
+			violations = append(violations, schemaViolation(path, "%q doesn't match %s", value, s.Pattern))
+		}
+	case json.Number:
+		if n, err := value.Float64(); err == nil && s.Minimum != nil && n < *s.Minimum {
+			violations = append(violations, schemaViolation(path, "%s is less than %v", value, *s.Minimum))
+		}
+	}
+
+	return violations
+}
+
+func schemaViolation(path, format string, args ...interface{}) Violation {
+	if path == "" {
+		path = "(root)"
+	}
+	return Violation{Rule: "schema", Message: path + ": " + fmt.Sprintf(format, args...)}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func schemaTypes(t interface{}) []string {
+	switch t := t.(type) {
+	case string:
+		return []string{t}
+	case []string:
+		return t
+	case []interface{}:
+		types := []string{}
+
+		for _, name := range t {
+			if s, ok := name.(string); ok {
+				types = append(types, s)
+			}
+		}
+
+		return types
+	}
+	return nil
+}
+
+func jsonType(doc interface{}) string {
+	switch value := doc.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := value.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", doc)
+}
+
+// Check a file against the schema. A JSON Lines file's header line is
+// checked against the header definition and every other line against the
+// card definition.
+func (s *JSONSchema) ValidateFile(path string) ([]Violation, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	if isJSONLines(path) {
+		return s.validateLines(file)
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(file))
+	dec.UseNumber()
+
+	var doc interface{}
+	err = dec.Decode(&doc)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Validate(doc), nil
+}
+
+func (s *JSONSchema) validateLines(r io.Reader) ([]Violation, error) {
+	violations := []Violation{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+
+	for scanner.Scan() {
+		line += 1
+
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		dec.UseNumber()
+
+		var doc map[string]interface{}
+		err := dec.Decode(&doc)
+
+		if err != nil {
+			return violations, fmt.Errorf("line %d: %s", line, err)
+		}
+
+		def := &JSONSchema{Ref: "#/$defs/card"}
+
+		if _, found := doc["schema_version"]; found && line == 1 {
+			def = &JSONSchema{Ref: "#/$defs/header"}
+		}
+
+		violations = append(violations, def.validate(s, doc, fmt.Sprintf("line %d", line))...)
+	}
+
+	return violations, scanner.Err()
+}
+
+func loadSchema(path string) (*JSONSchema, error) {
+	blob, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var schema JSONSchema
+	err = json.Unmarshal(blob, &schema)
+	return &schema, err
+}
+
+// frantic schema [-o cards.schema.json]
+func schemaCommand(args []string) error {
+	flags := flag.NewFlagSet("schema", flag.ExitOnError)
+	output := flags.String("o", "", "Write the schema to this file instead of stdout")
+	flags.Parse(args)
+
+	blob, err := json.MarshalIndent(GenerateSchema(), "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	blob = append(blob, '\n')
+
+	if *output == "" {
+		_, err = os.Stdout.Write(blob)
+		return err
+	}
+
+	return writeFileAtomic(*output, blob, FlushOptions{}, nil)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSchemaIsUpToDate(t *testing.T) {
+	blob, err := ioutil.ReadFile("cards.schema.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generated, _ := json.MarshalIndent(GenerateSchema(), "", "  ")
+
+	if string(blob) != string(generated)+"\n" {
+		t.Errorf("cards.schema.json is out of date, run ./frantic schema -o cards.schema.json")
+	}
+}
+
+func validateString(t *testing.T, doc string) []string {
+	dec := json.NewDecoder(strings.NewReader(doc))
+	dec.UseNumber()
+
+	var value interface{}
+	err := dec.Decode(&value)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := []string{}
+
+	for _, v := range GenerateSchema().Validate(value) {
+		messages = append(messages, v.Message)
+	}
+
+	return messages
+}
+
+func TestSchemaAcceptsFlushedCards(t *testing.T) {
+	card, err := loadCard(262699)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	box := Deckbox{Header: Header{Source: "test"}, Cards: []Card{card}}
+
+	blob, err := json.Marshal(&box)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if messages := validateString(t, string(blob)); len(messages) != 0 {
+		t.Errorf("A flushed card should match the schema: %v", messages)
+	}
+}
+
+func TestSchemaViolations(t *testing.T) {
+	id := OracleId("Foo")
+	doc := `{"schema_version": 1, "card_count": 1, "extra": true, "cards": [
+		{"name": "Foo", "id": "` + id + `", "types": null, "converted_cost": "1", "mana_cost": "{1}",
+		 "special": "sideways", "partner_card": "nope", "rules_text": [],
+		 "editions": [{"multiverse_id": 0}]}
+	]}`
+
+	expected := []string{
+		"cards[0].converted_cost: should be number, not string",
+		"cards[0].editions[0].multiverse_id: 0 is less than 1",
+		`cards[0].partner_card: "nope" doesn't match ^[0-9a-f]{32}$`,
+		`cards[0].special: "sideways" should be one of flip, double-faced, split`,
+		"(root): unexpected property extra",
+	}
+
+	messages := validateString(t, doc)
+
+	if strings.Join(messages, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected violations:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(messages, "\n"))
+	}
+
+	if messages := validateString(t, `[]`); len(messages) != 1 {
+		t.Errorf("A bare array isn't the current format: %v", messages)
+	}
+}
+
+func TestSchemaValidatesJSONLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frantic")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cards.jsonl")
+	err = AppendCards(path, []Card{Card{Id: OracleId("Foo"), Name: "Foo", Editions: []Edition{Edition{MultiverseId: 1}}}})
+
+	if err == nil {
+		err = AppendCards(path, []Card{Card{Id: "bad", Name: "Bar", Editions: []Edition{Edition{MultiverseId: 2}}}})
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	violations, err := GenerateSchema().ValidateFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(violations) != 1 || !strings.HasPrefix(violations[0].Message, "line 3.id:") {
+		t.Errorf("Only the bad id on line 3 should be a violation: %+v", violations)
+	}
+}
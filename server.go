@@ -0,0 +1,562 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// A read-only JSON API over a database. Every load builds a snapshot with
+// all of its indexes up front, so requests only ever read it and can run
+// concurrently. Reloading swaps in a new snapshot.
+
+const (
+	defaultPerPage = 100
+	maxPerPage     = 1000
+)
+
+type Server struct {
+	path string
+	mu   sync.RWMutex
+	snap *snapshot
+	// When and how big the file was when it was loaded
+	modTime time.Time
+	size    int64
+
+	randMu sync.Mutex
+	rand   *rand.Rand
+
+	graph *graphql.Schema
+}
+
+type snapshot struct {
+	box     Deckbox
+	names   *NameIndex
+	sets    []CountedName
+	artists []CountedName
+	// Printings by set and by artist
+	bySet    map[string][]printing
+	byArtist map[string][]printing
+}
+
+// A set or artist and how many printings it has
+type CountedName struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type Page struct {
+	Data    interface{} `json:"data"`
+	Total   int         `json:"total"`
+	Page    int         `json:"page"`
+	PerPage int         `json:"per_page"`
+	HasMore bool        `json:"has_more"`
+}
+
+func NewServer(path string) (*Server, error) {
+	s := &Server{
+		path:  path,
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+		graph: newGraphSchema(),
+	}
+
+	_, err := s.Reload()
+	return s, err
+}
+
+func newSnapshot(box Deckbox) *snapshot {
+	box.Sort()
+
+	return &snapshot{
+		box:      box,
+		names:    NewNameIndex(&box),
+		sets:     countEditions(&box, func(e Edition) string { return e.Set }),
+		artists:  countEditions(&box, func(e Edition) string { return e.Artist }),
+		bySet:    groupEditions(&box, func(e Edition) string { return e.Set }),
+		byArtist: groupEditions(&box, func(e Edition) string { return e.Artist }),
+	}
+}
+
+func countEditions(box *Deckbox, value func(Edition) string) []CountedName {
+	counts := map[string]int{}
+
+	for _, card := range box.Cards {
+		for _, e := range card.Editions {
+			if v := value(e); v != "" {
+				counts[v] += 1
+			}
+		}
+	}
+
+	names := []CountedName{}
+
+	for name, count := range counts {
+		names = append(names, CountedName{Name: name, Count: count})
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		return names[i].Name < names[j].Name
+	})
+
+	return names
+}
+
+// Load the database again if the file has changed since it was last
+// loaded. Returns whether it was reloaded. A database that fails to load
+// leaves the old one in place.
+func (s *Server) Reload() (bool, error) {
+	info, err := os.Stat(s.path)
+
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.RLock()
+	unchanged := s.snap != nil && info.ModTime().Equal(s.modTime) && info.Size() == s.size
+	s.mu.RUnlock()
+
+	if unchanged {
+		return false, nil
+	}
+
+	box, err := openDeckbox(s.path)
+
+	if err != nil {
+		return false, err
+	}
+
+	snap := newSnapshot(box)
+
+	s.mu.Lock()
+	s.snap = snap
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	s.mu.Unlock()
+
+	return true, nil
+}
+
+// Check for changes to the database every interval
+func (s *Server) Watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		reloaded, err := s.Reload()
+
+		if err != nil {
+			log.Printf("WARNING: Couldn't reload %s: %s", s.path, err)
+		} else if reloaded {
+			log.Printf("Reloaded %s", s.path)
+		}
+	}
+}
+
+func (s *Server) current() *snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.snap
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cards", s.handleSearch)
+	mux.HandleFunc("/cards/", s.handleCard)
+	mux.HandleFunc("/multiverse/", s.handleMultiverse)
+	mux.HandleFunc("/autocomplete", s.handleAutocomplete)
+	mux.HandleFunc("/random", s.handleRandom)
+	mux.HandleFunc("/sets", s.handleSets)
+	mux.HandleFunc("/artists", s.handleArtists)
+	mux.HandleFunc("/graphql", s.handleGraphQL)
+	return mux
+}
+
+type apiError struct {
+	status      int
+	message     string
+	suggestions []string
+}
+
+func (e apiError) Error() string {
+	return e.message
+}
+
+func notFound(format string, args ...interface{}) apiError {
+	return apiError{status: http.StatusNotFound, message: fmt.Sprintf(format, args...)}
+}
+
+func badRequest(format string, args ...interface{}) apiError {
+	return apiError{status: http.StatusBadRequest, message: fmt.Sprintf(format, args...)}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	e, ok := err.(apiError)
+
+	if !ok {
+		e = apiError{status: http.StatusInternalServerError, message: err.Error()}
+	}
+
+	body := map[string]interface{}{"error": e.message}
+
+	if e.suggestions != nil {
+		body["suggestions"] = e.suggestions
+	}
+
+	blob, _ := json.Marshal(body)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.status)
+	w.Write(append(blob, '\n'))
+}
+
+// Write a JSON response with an ETag, or 304 if the client already has it
+func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	blob, err := json.Marshal(v)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	etag := fmt.Sprintf(`"%x"`, md5.Sum(blob))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", "application/json")
+
+	if matchesETag(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Write(append(blob, '\n'))
+}
+
+func matchesETag(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(tag), "W/"))
+
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func getOnly(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, apiError{status: http.StatusMethodNotAllowed, message: "only GET is supported"})
+		return false
+	}
+	return true
+}
+
+// Slice items according to the page and per_page parameters
+func paginate(query url.Values, total int) (start, end int, page Page, err error) {
+	page = Page{Page: 1, PerPage: defaultPerPage, Total: total}
+
+	if p := query.Get("page"); p != "" {
+		page.Page, err = strconv.Atoi(p)
+
+		if err != nil || page.Page < 1 {
+			return 0, 0, page, badRequest("page should be a positive number, not %q", p)
+		}
+	}
+
+	if p := query.Get("per_page"); p != "" {
+		page.PerPage, err = strconv.Atoi(p)
+
+		if err != nil || page.PerPage < 1 || page.PerPage > maxPerPage {
+			return 0, 0, page, badRequest("per_page should be between 1 and %d, not %q", maxPerPage, p)
+		}
+	}
+
+	// Pages past the end are empty. Check before multiplying so a huge page
+	// number can't overflow.
+	if page.Page-1 > total/page.PerPage {
+		start = total
+	} else {
+		start = (page.Page - 1) * page.PerPage
+	}
+
+	if start > total {
+		start = total
+	}
+
+	end = start + page.PerPage
+
+	if end > total {
+		end = total
+	}
+
+	page.HasMore = end < total
+	return start, end, page, nil
+}
+
+// Build a query from the request. q takes the query language, and every
+// other parameter named after a field is a condition on it. Numeric fields
+// can start their value with an operator, e.g. cmc=>=3.
+func requestQuery(query url.Values) (Query, error) {
+	terms := []Query{}
+
+	if q := query.Get("q"); q != "" {
+		parsed, err := ParseQuery(q)
+
+		if err != nil {
+			return nil, badRequest("%s", err)
+		}
+
+		terms = append(terms, parsed)
+	}
+
+	keys := []string{}
+
+	for key := range query {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if _, found := findField(key); !found {
+			continue
+		}
+
+		for _, value := range query[key] {
+			op := ":"
+
+			for _, o := range queryOps {
+				if strings.HasPrefix(value, o) {
+					op, value = o, strings.TrimPrefix(value, o)
+					break
+				}
+			}
+
+			c, err := newCondition(key, op, value)
+
+			if err != nil {
+				return nil, badRequest("%s", err)
+			}
+
+			terms = append(terms, c)
+		}
+	}
+
+	return AndQuery{Terms: terms}, nil
+}
+
+// GET /cards?q=t:creature&set=alpha&page=2
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if !getOnly(w, r) {
+		return
+	}
+
+	snap := s.current()
+	q, err := requestQuery(r.URL.Query())
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	matches := snap.box.Search(q)
+	start, end, page, err := paginate(r.URL.Query(), len(matches))
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	page.Data = matches[start:end]
+	writeJSON(w, r, page)
+}
+
+// GET /cards/{id} and GET /cards/named?name=huntmaster&fuzzy=true
+func (s *Server) handleCard(w http.ResponseWriter, r *http.Request) {
+	if !getOnly(w, r) {
+		return
+	}
+
+	snap := s.current()
+	id := strings.TrimPrefix(r.URL.Path, "/cards/")
+
+	if id == "named" {
+		s.handleNamed(w, r, snap)
+		return
+	}
+
+	card, found := snap.box.ById(id)
+
+	if !found {
+		writeError(w, notFound("no card with id %s", id))
+		return
+	}
+
+	writeJSON(w, r, card)
+}
+
+func (s *Server) handleNamed(w http.ResponseWriter, r *http.Request, snap *snapshot) {
+	name := r.URL.Query().Get("name")
+
+	if name == "" {
+		writeError(w, badRequest("name is required"))
+		return
+	}
+
+	if fuzzy, _ := strconv.ParseBool(r.URL.Query().Get("fuzzy")); !fuzzy {
+		match, found := snap.names.Lookup(name)
+
+		if !found {
+			writeError(w, notFound("no card named %q", name))
+			return
+		}
+
+		writeJSON(w, r, match)
+		return
+	}
+
+	match, err := snap.names.Find(name)
+
+	if e, ok := err.(NameNotFound); ok {
+		writeError(w, apiError{status: http.StatusNotFound, message: e.Error(), suggestions: matchNames(e.Suggestions)})
+		return
+	}
+
+	writeJSON(w, r, match)
+}
+
+// GET /multiverse/{id}
+func (s *Server) handleMultiverse(w http.ResponseWriter, r *http.Request) {
+	if !getOnly(w, r) {
+		return
+	}
+
+	snap := s.current()
+	param := strings.TrimPrefix(r.URL.Path, "/multiverse/")
+	id, err := strconv.Atoi(param)
+
+	if err != nil {
+		writeError(w, badRequest("multiverse id should be a number, not %q", param))
+		return
+	}
+
+	cards := snap.box.ByMultiverseId(id)
+
+	if len(cards) == 0 {
+		writeError(w, notFound("no card with multiverse id %d", id))
+		return
+	}
+
+	writeJSON(w, r, cards)
+}
+
+// GET /autocomplete?q=hunt&limit=10
+func (s *Server) handleAutocomplete(w http.ResponseWriter, r *http.Request) {
+	if !getOnly(w, r) {
+		return
+	}
+
+	snap := s.current()
+	limit := 20
+
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+
+		if err != nil || n < 1 || n > maxPerPage {
+			writeError(w, badRequest("limit should be between 1 and %d, not %q", maxPerPage, l))
+			return
+		}
+
+		limit = n
+	}
+
+	writeJSON(w, r, matchNames(snap.names.Complete(r.URL.Query().Get("q"), limit)))
+}
+
+// GET /random, optionally with the same filters as /cards
+func (s *Server) handleRandom(w http.ResponseWriter, r *http.Request) {
+	if !getOnly(w, r) {
+		return
+	}
+
+	snap := s.current()
+	q, err := requestQuery(r.URL.Query())
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	matches := snap.box.Search(q)
+
+	if len(matches) == 0 {
+		writeError(w, notFound("no cards match"))
+		return
+	}
+
+	s.randMu.Lock()
+	card := matches[s.rand.Intn(len(matches))]
+	s.randMu.Unlock()
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, r, card)
+}
+
+// GET /sets
+func (s *Server) handleSets(w http.ResponseWriter, r *http.Request) {
+	s.handleNames(w, r, s.current().sets)
+}
+
+// GET /artists
+func (s *Server) handleArtists(w http.ResponseWriter, r *http.Request) {
+	s.handleNames(w, r, s.current().artists)
+}
+
+func (s *Server) handleNames(w http.ResponseWriter, r *http.Request, names []CountedName) {
+	if !getOnly(w, r) {
+		return
+	}
+
+	start, end, page, err := paginate(r.URL.Query(), len(names))
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	page.Data = names[start:end]
+	writeJSON(w, r, page)
+}
+
+// frantic serve [-addr :8080] [-reload 5s] cards.json
+func serveCommand(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", ":8080", "The address to listen on")
+	reload := flags.Duration("reload", 5*time.Second, "How often to check the database for changes, 0 to never")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: serve [-addr :8080] [-reload 5s] cards.json")
+	}
+
+	s, err := NewServer(flags.Arg(0))
+
+	if err != nil {
+		return err
+	}
+
+	if *reload > 0 {
+		go s.Watch(*reload)
+	}
+
+	log.Printf("Serving %d cards on %s", len(s.current().box.Cards), *addr)
+	return http.ListenAndServe(*addr, s.Handler())
+}
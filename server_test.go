@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func serverBox() Deckbox {
+	box := *nameBox()
+
+	for i := range box.Cards {
+		box.Cards[i].Types = []string{"creature"}
+		box.Cards[i].Editions = []Edition{Edition{MultiverseId: 100 + i, Set: "Alpha", Artist: "Amy Weber"}}
+	}
+
+	box.Cards[0].ConvertedCost = 4
+	box.Cards[2].Editions[0].MultiverseId = 102
+	box.Cards[3].Editions[0].MultiverseId = 102
+	box.Cards[4].Editions[0].Set = "Tempest"
+	box.Cards[4].Types = []string{"artifact"}
+
+	return box
+}
+
+func testServer(t *testing.T) (*Server, string, func()) {
+	dir, err := ioutil.TempDir("", "frantic")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "cards.json")
+	box := serverBox()
+	err = box.FlushWith(path, FlushOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewServer(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, path, func() { os.RemoveAll(dir) }
+}
+
+func get(t *testing.T, h http.Handler, url string, header map[string]string, v interface{}) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", url, nil)
+
+	for key, value := range header {
+		r.Header.Set(key, value)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if v != nil && w.Code == http.StatusOK {
+		err := json.Unmarshal(w.Body.Bytes(), v)
+
+		if err != nil {
+			t.Fatalf("%s: %s", url, err)
+		}
+	}
+
+	return w
+}
+
+func TestServerLookups(t *testing.T) {
+	s, _, cleanup := testServer(t)
+	defer cleanup()
+
+	h := s.Handler()
+
+	var card Card
+
+	if w := get(t, h, "/cards/"+OracleId("Lord of the Pit"), nil, &card); w.Code != 200 || card.Name != "Lord of the Pit" {
+		t.Errorf("Lookup by id failed: %d %s", w.Code, w.Body)
+	}
+
+	if w := get(t, h, "/cards/nope", nil, nil); w.Code != 404 {
+		t.Errorf("Unknown ids should be 404, not %d", w.Code)
+	}
+
+	var match NameMatch
+
+	if w := get(t, h, "/cards/named?name=stand/deliver", nil, &match); w.Code != 200 || len(match.Cards) != 2 {
+		t.Errorf("Lookup by name failed: %d %s", w.Code, w.Body)
+	}
+
+	if w := get(t, h, "/cards/named?name=huntmaster+of+the+fels", nil, nil); w.Code != 404 {
+		t.Errorf("Misspelled names should only match when fuzzy: %d", w.Code)
+	}
+
+	if w := get(t, h, "/cards/named?name=huntmaster+of+the+fels&fuzzy=true", nil, &match); w.Code != 200 || match.Distance != 1 {
+		t.Errorf("Fuzzy lookup failed: %d %s", w.Code, w.Body)
+	}
+
+	w := get(t, h, "/cards/named?name=lord&fuzzy=true", nil, nil)
+	var failure struct {
+		Suggestions []string `json:"suggestions"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &failure)
+
+	if w.Code != 404 || len(failure.Suggestions) != 2 {
+		t.Errorf("Ambiguous names should come with suggestions: %d %s", w.Code, w.Body)
+	}
+
+	var cards []Card
+
+	if w := get(t, h, "/multiverse/102", nil, &cards); w.Code != 200 || len(cards) != 2 {
+		t.Errorf("Both halves of a split card share a multiverse id: %d %s", w.Code, w.Body)
+	}
+
+	if w := get(t, h, "/multiverse/abc", nil, nil); w.Code != 400 {
+		t.Errorf("Bad multiverse ids should be 400, not %d", w.Code)
+	}
+}
+
+func TestServerSearch(t *testing.T) {
+	s, _, cleanup := testServer(t)
+	defer cleanup()
+
+	h := s.Handler()
+
+	var page struct {
+		Data    []Card `json:"data"`
+		Total   int    `json:"total"`
+		HasMore bool   `json:"has_more"`
+	}
+
+	if w := get(t, h, "/cards?t=creature&per_page=3", nil, &page); w.Code != 200 || page.Total != 8 || len(page.Data) != 3 || !page.HasMore {
+		t.Errorf("First page is wrong: %d %+v", w.Code, page)
+	}
+
+	if w := get(t, h, "/cards?t=creature&per_page=3&page=3", nil, &page); w.Code != 200 || len(page.Data) != 2 || page.HasMore {
+		t.Errorf("Last page is wrong: %d %+v", w.Code, page)
+	}
+
+	if get(t, h, "/cards?cmc=>=4&q=fells", nil, &page); page.Total != 1 || page.Data[0].Name != "Huntmaster of the Fells" {
+		t.Errorf("Filters should combine: %+v", page)
+	}
+
+	if w := get(t, h, "/cards?q=cmc>three", nil, nil); w.Code != 400 {
+		t.Errorf("Bad queries should be 400, not %d", w.Code)
+	}
+
+	for _, path := range []string{"/cards?page=9223372036854775807", "/sets?page=9223372036854775807"} {
+		var empty struct {
+			Data    []interface{} `json:"data"`
+			HasMore bool          `json:"has_more"`
+		}
+
+		if w := get(t, h, path, nil, &empty); w.Code != 200 || len(empty.Data) != 0 || empty.HasMore {
+			t.Errorf("%s should be an empty page: %d %s", path, w.Code, w.Body)
+		}
+	}
+
+	if w := get(t, h, "/cards?per_page=0", nil, nil); w.Code != 400 {
+		t.Errorf("Bad page sizes should be 400, not %d", w.Code)
+	}
+
+	var names []string
+
+	if get(t, h, "/autocomplete?q=lord&limit=1", nil, &names); len(names) != 1 || names[0] != "Lord of Atlantis" {
+		t.Errorf("Autocomplete failed: %v", names)
+	}
+
+	var card Card
+
+	if w := get(t, h, "/random?t=artifact", nil, &card); w.Code != 200 || card.Name != "Æther Vial" {
+		t.Errorf("Random card should match the filters: %d %s", w.Code, w.Body)
+	}
+
+	var sets struct {
+		Data []CountedName `json:"data"`
+	}
+
+	if get(t, h, "/sets", nil, &sets); len(sets.Data) != 2 || sets.Data[0].Name != "Alpha" || sets.Data[0].Count != 8 {
+		t.Errorf("Sets are wrong: %+v", sets)
+	}
+
+	if get(t, h, "/artists", nil, &sets); len(sets.Data) != 1 || sets.Data[0].Count != 9 {
+		t.Errorf("Artists are wrong: %+v", sets)
+	}
+}
+
+func TestServerETag(t *testing.T) {
+	s, _, cleanup := testServer(t)
+	defer cleanup()
+
+	h := s.Handler()
+	w := get(t, h, "/sets", nil, nil)
+	etag := w.Header().Get("ETag")
+
+	if etag == "" {
+		t.Fatalf("Responses should have an ETag")
+	}
+
+	if w := get(t, h, "/sets", map[string]string{"If-None-Match": etag}, nil); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("A matching ETag should be 304, not %d", w.Code)
+	}
+
+	if w := get(t, h, "/sets", map[string]string{"If-None-Match": `"stale"`}, nil); w.Code != 200 {
+		t.Errorf("A stale ETag should get the body, not %d", w.Code)
+	}
+}
+
+func TestServerReload(t *testing.T) {
+	s, path, cleanup := testServer(t)
+	defer cleanup()
+
+	if reloaded, err := s.Reload(); err != nil || reloaded {
+		t.Errorf("An unchanged file shouldn't reload: %v %v", reloaded, err)
+	}
+
+	box := serverBox()
+	box.Cards = box.Cards[:2]
+	err := box.FlushWith(path, FlushOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Make sure the change is visible even on coarse file systems
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+
+	if reloaded, err := s.Reload(); err != nil || !reloaded {
+		t.Fatalf("A changed file should reload: %v %v", reloaded, err)
+	}
+
+	if n := len(s.current().box.Cards); n != 2 {
+		t.Errorf("Reloaded database should have 2 cards, not %d", n)
+	}
+
+	ioutil.WriteFile(path, []byte("not json"), 0644)
+	os.Chtimes(path, later.Add(time.Minute), later.Add(time.Minute))
+
+	if _, err := s.Reload(); err == nil {
+		t.Errorf("A broken file should fail to reload")
+	}
+
+	if n := len(s.current().box.Cards); n != 2 {
+		t.Errorf("A broken file should leave the old database in place, found %d cards", n)
+	}
+}
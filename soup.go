@@ -1,7 +1,7 @@
 package main
 
 import (
-	"code.google.com/p/go.net/html"
+	"golang.org/x/net/html"
 	"strings"
 )
 
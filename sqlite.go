@@ -0,0 +1,468 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// The metadata table holds the header fields, one row each: schema_version,
+// generated_at and source. Cards are split across normalized tables. Rules text, flavor text and
+// color indicators keep their order by joining lines with a newline.
+// cards_fts indexes card names and rules text for full-text search:
+//
+//	SELECT name FROM cards_fts WHERE cards_fts MATCH 'rules_text:flying';
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS metadata (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS cards (
+	id              TEXT PRIMARY KEY,
+	name            TEXT NOT NULL,
+	mana_cost       TEXT NOT NULL DEFAULT '',
+	converted_cost  REAL NOT NULL DEFAULT 0,
+	special         TEXT NOT NULL DEFAULT '',
+	partner_card    TEXT NOT NULL DEFAULT '',
+	side            TEXT NOT NULL DEFAULT '',
+	rules_text      TEXT NOT NULL DEFAULT '',
+	color_indicator TEXT NOT NULL DEFAULT '',
+	power           TEXT NOT NULL DEFAULT '',
+	toughness       TEXT NOT NULL DEFAULT '',
+	loyalty         INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS sets (
+	id   INTEGER PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS artists (
+	id   INTEGER PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS types (
+	id   INTEGER PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS card_types (
+	card_id  TEXT NOT NULL REFERENCES cards(id),
+	type_id  INTEGER NOT NULL REFERENCES types(id),
+	subtype  INTEGER NOT NULL,
+	position INTEGER NOT NULL,
+	PRIMARY KEY (card_id, subtype, position)
+);
+
+CREATE TABLE IF NOT EXISTS editions (
+	card_id       TEXT NOT NULL REFERENCES cards(id),
+	multiverse_id INTEGER NOT NULL,
+	set_id        INTEGER REFERENCES sets(id),
+	artist_id     INTEGER REFERENCES artists(id),
+	rarity        TEXT NOT NULL DEFAULT '',
+	watermark     TEXT NOT NULL DEFAULT '',
+	number        TEXT NOT NULL DEFAULT '',
+	flavor_text   TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (card_id, multiverse_id)
+);
+
+CREATE INDEX IF NOT EXISTS cards_name ON cards(name);
+CREATE INDEX IF NOT EXISTS card_types_type ON card_types(type_id);
+CREATE INDEX IF NOT EXISTS editions_multiverse_id ON editions(multiverse_id);
+CREATE INDEX IF NOT EXISTS editions_set ON editions(set_id);
+CREATE INDEX IF NOT EXISTS editions_artist ON editions(artist_id);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS cards_fts USING fts5(card_id UNINDEXED, name, rules_text);
+`
+
+// Cards stored in a SQLite database
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+func OpenSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var existing int
+	err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'cards'").Scan(&existing)
+
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	_, err = db.Exec(sqliteSchema)
+
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// Databases from before sides were recorded don't have the column
+	var sides int
+	err = db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('cards') WHERE name = 'side'").Scan(&sides)
+
+	if err == nil && sides == 0 {
+		_, err = db.Exec("ALTER TABLE cards ADD COLUMN side TEXT NOT NULL DEFAULT ''")
+	}
+
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// A new database starts at the current version
+	if existing == 0 {
+		_, err = db.Exec("INSERT INTO metadata (key, value) VALUES ('schema_version', ?)",
+			strconv.Itoa(currentSchemaVersion()))
+
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteStore) Update(box *Deckbox, changed []Card) error {
+	return s.write(box, changed, false)
+}
+
+func (s *SQLiteStore) Flush(box *Deckbox) error {
+	err := s.write(box, box.Cards, true)
+
+	if err == nil {
+		box.Header.SchemaVersion = currentSchemaVersion()
+	}
+
+	return err
+}
+
+// Write cards and the header in a single transaction, optionally removing
+// everything already in the database first. Only a replace records the
+// current schema version, since until then older cards are still stored.
+func (s *SQLiteStore) write(box *Deckbox, cards []Card, replace bool) error {
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	if replace {
+		for _, table := range []string{"card_types", "editions", "cards_fts", "cards", "types", "sets", "artists"} {
+			_, err := tx.Exec("DELETE FROM " + table)
+
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+
+	for _, card := range cards {
+		err := upsertCard(tx, card)
+
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	metadata := map[string]string{
+		"generated_at": box.Header.GeneratedAt,
+		"source":       box.Header.Source,
+	}
+
+	if replace {
+		metadata["schema_version"] = strconv.Itoa(currentSchemaVersion())
+	}
+
+	for key, value := range metadata {
+		_, err := tx.Exec("INSERT OR REPLACE INTO metadata (key, value) VALUES (?, ?)", key, value)
+
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Databases written before the version was stored hold version 1 cards, the
+// version when SQLite support was added
+func (s *SQLiteStore) readHeader() (Header, error) {
+	header := Header{SchemaVersion: 1}
+
+	rows, err := s.db.Query("SELECT key, value FROM metadata")
+
+	if err != nil {
+		return header, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var key, value string
+
+		err := rows.Scan(&key, &value)
+
+		if err != nil {
+			return header, err
+		}
+
+		switch key {
+		case "schema_version":
+			header.SchemaVersion, err = strconv.Atoi(value)
+
+			if err != nil {
+				return header, fmt.Errorf("bad schema version %q: %s", value, err)
+			}
+		case "generated_at":
+			header.GeneratedAt = value
+		case "source":
+			header.Source = value
+		}
+	}
+
+	return header, rows.Err()
+}
+
+func upsertCard(tx *sql.Tx, card Card) error {
+	for _, table := range []string{"card_types", "editions", "cards_fts", "cards"} {
+		column := "card_id"
+
+		if table == "cards" {
+			column = "id"
+		}
+
+		_, err := tx.Exec("DELETE FROM "+table+" WHERE "+column+" = ?", card.Id)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	rules := strings.Join(card.RulesText, "\n")
+
+	_, err := tx.Exec(`INSERT INTO cards (id, name, mana_cost, converted_cost, special, partner_card, side,
+		rules_text, color_indicator, power, toughness, loyalty) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		card.Id, card.Name, card.ManaCost, card.ConvertedCost, card.Special, card.PartnerCard, card.Side,
+		rules, strings.Join(card.ColorIndicator, "\n"), card.Power, card.Toughness, card.Loyalty)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO cards_fts (card_id, name, rules_text) VALUES (?, ?, ?)", card.Id, card.Name, rules)
+
+	if err != nil {
+		return err
+	}
+
+	for subtype, types := range [][]string{card.Types, card.Subtypes} {
+		for position, name := range types {
+			typeId, err := lookupId(tx, "types", name)
+
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec("INSERT INTO card_types (card_id, type_id, subtype, position) VALUES (?, ?, ?, ?)",
+				card.Id, typeId, subtype, position)
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, e := range card.Editions {
+		setId, err := lookupId(tx, "sets", e.Set)
+
+		if err != nil {
+			return err
+		}
+
+		artistId, err := lookupId(tx, "artists", e.Artist)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO editions (card_id, multiverse_id, set_id, artist_id, rarity, watermark,
+			number, flavor_text) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			card.Id, e.MultiverseId, setId, artistId, e.Rarity, e.Watermark, e.Number,
+			strings.Join(e.FlavorText, "\n"))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Find or create the row for name in a lookup table. Empty names are NULL.
+func lookupId(tx *sql.Tx, table, name string) (sql.NullInt64, error) {
+	var id sql.NullInt64
+
+	if name == "" {
+		return id, nil
+	}
+
+	_, err := tx.Exec("INSERT OR IGNORE INTO "+table+" (name) VALUES (?)", name)
+
+	if err != nil {
+		return id, err
+	}
+
+	err = tx.QueryRow("SELECT id FROM "+table+" WHERE name = ?", name).Scan(&id)
+	return id, err
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+	return strings.Split(text, "\n")
+}
+
+// Load the cards and upgrade them to the current schema
+func (s *SQLiteStore) Load() (Deckbox, error) {
+	box, err := s.read()
+
+	if err != nil {
+		return box, err
+	}
+
+	err = box.upgrade()
+	return box, err
+}
+
+// Read every card as stored, without upgrading them
+func (s *SQLiteStore) read() (Deckbox, error) {
+	box := Deckbox{Cards: []Card{}}
+	positions := map[string]int{}
+
+	header, err := s.readHeader()
+
+	if err != nil {
+		return box, err
+	}
+
+	box.Header = header
+
+	rows, err := s.db.Query(`SELECT id, name, mana_cost, converted_cost, special, partner_card, side, rules_text,
+		color_indicator, power, toughness, loyalty FROM cards ORDER BY name, id`)
+
+	if err != nil {
+		return box, err
+	}
+
+	for rows.Next() {
+		var card Card
+		var rules, colors string
+
+		err := rows.Scan(&card.Id, &card.Name, &card.ManaCost, &card.ConvertedCost, &card.Special,
+			&card.PartnerCard, &card.Side, &rules, &colors, &card.Power, &card.Toughness, &card.Loyalty)
+
+		if err != nil {
+			rows.Close()
+			return box, err
+		}
+
+		card.RulesText = splitLines(rules)
+		card.Types = []string{}
+		card.Subtypes = []string{}
+
+		if colors != "" {
+			card.ColorIndicator = splitLines(colors)
+		}
+
+		positions[card.Id] = len(box.Cards)
+		box.Cards = append(box.Cards, card)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return box, err
+	}
+
+	rows, err = s.db.Query(`SELECT card_types.card_id, card_types.subtype, types.name FROM card_types
+		JOIN types ON types.id = card_types.type_id ORDER BY card_types.card_id, card_types.subtype, card_types.position`)
+
+	if err != nil {
+		return box, err
+	}
+
+	for rows.Next() {
+		var id, name string
+		var subtype bool
+
+		err := rows.Scan(&id, &subtype, &name)
+
+		if err != nil {
+			rows.Close()
+			return box, err
+		}
+
+		card := &box.Cards[positions[id]]
+
+		if subtype {
+			card.Subtypes = append(card.Subtypes, name)
+		} else {
+			card.Types = append(card.Types, name)
+		}
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return box, err
+	}
+
+	rows, err = s.db.Query(`SELECT editions.card_id, editions.multiverse_id, COALESCE(sets.name, ''),
+		COALESCE(artists.name, ''), editions.rarity, editions.watermark, editions.number, editions.flavor_text
+		FROM editions LEFT JOIN sets ON sets.id = editions.set_id LEFT JOIN artists ON artists.id = editions.artist_id
+		ORDER BY editions.card_id, editions.multiverse_id`)
+
+	if err != nil {
+		return box, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, flavor string
+		var e Edition
+
+		err := rows.Scan(&id, &e.MultiverseId, &e.Set, &e.Artist, &e.Rarity, &e.Watermark, &e.Number, &flavor)
+
+		if err != nil {
+			return box, err
+		}
+
+		e.FlavorText = splitLines(flavor)
+		card := &box.Cards[positions[id]]
+		card.Editions = append(card.Editions, e)
+	}
+
+	box.reindex()
+	return box, rows.Err()
+}
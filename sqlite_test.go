@@ -0,0 +1,248 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frantic")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cards.db")
+	box := Deckbox{}
+	box.Add(Card{Id: "a", Name: "Alpha", Editions: []Edition{Edition{MultiverseId: 1, Set: "Alpha"}}})
+
+	err = exportFormats["database"].write(&box, ExportOptions{Output: path})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if blob, _ := ioutil.ReadFile(path); !strings.HasPrefix(string(blob), "SQLite format 3") {
+		t.Errorf("%s should be a SQLite database", path)
+	}
+
+	loaded, err := openDeckbox(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if card, found := loaded.ById("a"); !found || card.Name != "Alpha" {
+		t.Errorf("The copy should hold Alpha: %+v", loaded.Cards)
+	}
+}
+
+func TestSQLiteStoreRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frantic")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	store, err := openStore(filepath.Join(dir, "cards.db"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer store.Close()
+
+	box := Deckbox{}
+
+	for _, id := range []int{21382, 189211, 262875, 262699, 20574, 205740} {
+		card, err := loadCard(id)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		box.Add(card)
+	}
+
+	err = store.Flush(&box)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := store.Load()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(loaded.Cards) != len(box.Cards) {
+		t.Fatalf("Loaded %d cards, expected %d", len(loaded.Cards), len(box.Cards))
+	}
+
+	for _, card := range box.Cards {
+		found, ok := loaded.ById(card.Id)
+
+		if !ok {
+			t.Errorf("%s is missing from the database", card.Name)
+			continue
+		}
+
+		expected, _ := json.Marshal(card)
+		actual, _ := json.Marshal(found)
+
+		if string(expected) != string(actual) {
+			t.Errorf("%s didn't survive a round trip:\n%s\ninstead of\n%s", card.Name, actual, expected)
+		}
+	}
+
+	changed := Card{Id: "new", Name: "New Card", Types: []string{"instant"}, Editions: []Edition{Edition{MultiverseId: 1, Set: "Alpha"}}}
+	err = store.Update(&box, []Card{changed})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err = store.Load()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(loaded.Cards) != len(box.Cards)+1 {
+		t.Errorf("Update should add one card, loaded %d", len(loaded.Cards))
+	}
+}
+
+func TestSQLiteSchemaVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frantic")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	store, err := OpenSQLiteStore(filepath.Join(dir, "cards.db"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer store.Close()
+
+	box, err := store.Load()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if box.Header.SchemaVersion != currentSchemaVersion() {
+		t.Errorf("A new database should be at version %d, not %d", currentSchemaVersion(), box.Header.SchemaVersion)
+	}
+
+	// Cards stored by an older version
+	card := Card{Name: "Elspeth Tirel", ManaCost: "{3}{W}{W}"}
+	card.Id = legacyId(card)
+	box.Header = Header{GeneratedAt: "2013-01-02T03:04:05Z", Source: "test"}
+
+	err = store.Update(&box, []Card{card})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.db.Exec("UPDATE metadata SET value = '0' WHERE key = 'schema_version'")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := store.Load()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Header.SchemaVersion != 0 || loaded.Header.Source != "test" || loaded.Header.GeneratedAt != "2013-01-02T03:04:05Z" {
+		t.Errorf("Header wasn't read from the metadata table: %+v", loaded.Header)
+	}
+
+	if loaded.Cards[0].Id != OracleId(card.Name) {
+		t.Errorf("Loading version 0 should migrate ids, got %s", loaded.Cards[0].Id)
+	}
+
+	err = store.Flush(&loaded)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.read()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.Header.SchemaVersion != currentSchemaVersion() || stored.Cards[0].Id != OracleId(card.Name) {
+		t.Errorf("Flush should store the upgraded cards at version %d: %+v", currentSchemaVersion(), stored.Header)
+	}
+}
+
+// Databases from before sides were recorded get the column added
+func TestSQLiteAddsSideColumn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frantic")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cards.db")
+	db, err := sql.Open("sqlite", path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec(strings.Replace(sqliteSchema, "\tside            TEXT NOT NULL DEFAULT '',\n", "", 1))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec("INSERT INTO cards (id, name) VALUES ('stand', 'Stand')")
+	db.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := OpenSQLiteStore(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer store.Close()
+
+	box, err := store.Load()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(box.Cards) != 1 || box.Cards[0].Name != "Stand" || box.Cards[0].Side != "" {
+		t.Errorf("The old database should load without sides: %+v", box.Cards)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"path/filepath"
+)
+
+// A Store is somewhere a Deckbox is kept between runs
+type Store interface {
+	Load() (Deckbox, error)
+	// Save cards that changed since the last Update or Flush
+	Update(box *Deckbox, changed []Card) error
+	// Replace everything in the store with the deckbox
+	Flush(box *Deckbox) error
+	Close() error
+}
+
+// Pick a store from the file extension. SQLite databases end in .db,
+// .sqlite or .sqlite3, anything else is a JSON file.
+func openStore(path string) (Store, error) {
+	if isSQLite(path) {
+		return OpenSQLiteStore(path)
+	}
+	return JSONStore{Path: path}, nil
+}
+
+func isSQLite(path string) bool {
+	switch filepath.Ext(path) {
+	case ".db", ".sqlite", ".sqlite3":
+		return true
+	}
+	return false
+}
+
+// Cards stored as a JSON array or JSON Lines
+type JSONStore struct {
+	Path string
+}
+
+func (s JSONStore) Load() (Deckbox, error) {
+	return loadDeckBox(s.Path)
+}
+
+// JSON Lines files only need the changed cards appended, JSON arrays are
+// rewritten from scratch and verified before they replace the old file.
+func (s JSONStore) Update(box *Deckbox, changed []Card) error {
+	if isJSONLines(s.Path) {
+		return AppendCards(s.Path, changed)
+	}
+	return box.Flush(s.Path)
+}
+
+func (s JSONStore) Flush(box *Deckbox) error {
+	if isJSONLines(s.Path) {
+		return box.FlushLines(s.Path)
+	}
+	return box.Flush(s.Path)
+}
+
+func (s JSONStore) Close() error {
+	return nil
+}
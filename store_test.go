@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJSONStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frantic")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"cards.json", "cards.jsonl"} {
+		store, err := openStore(filepath.Join(dir, name))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := store.(JSONStore); !ok {
+			t.Errorf("%s should be stored as JSON", name)
+		}
+
+		box := Deckbox{}
+		box.Add(Card{Id: "A", Editions: []Edition{Edition{MultiverseId: 1}}})
+		err = store.Update(&box, box.Cards)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		box.Add(Card{Id: "B", Editions: []Edition{Edition{MultiverseId: 2}}})
+		err = store.Update(&box, box.Cards[1:])
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		loaded, err := store.Load()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(loaded.Cards) != 2 {
+			t.Errorf("%s should have 2 cards, not %d", name, len(loaded.Cards))
+		}
+	}
+}
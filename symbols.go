@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A ManaSymbol describes one symbol Gatherer renders as an image. Alt is the
+// image's alt text and Symbol is the canonical form we store, e.g. {2/G}.
+type ManaSymbol struct {
+	Alt       string   `json:"alt"`
+	Symbol    string   `json:"symbol"`
+	Colors    []string `json:"colors,omitempty"`
+	CMC       float64  `json:"cmc"`
+	Hybrid    bool     `json:"hybrid,omitempty"`
+	Phyrexian bool     `json:"phyrexian,omitempty"`
+}
+
+type SymbolTable struct {
+	mu       sync.RWMutex
+	byAlt    map[string]ManaSymbol
+	bySymbol map[string]ManaSymbol
+	unknown  map[string]int
+}
+
+func NewSymbolTable(symbols []ManaSymbol) *SymbolTable {
+	t := &SymbolTable{
+		byAlt:    map[string]ManaSymbol{},
+		bySymbol: map[string]ManaSymbol{},
+		unknown:  map[string]int{},
+	}
+
+	for _, s := range symbols {
+		t.Register(s)
+	}
+
+	return t
+}
+
+// Add or replace a symbol. Later registrations win, so a symbols file can
+// override the built in table.
+func (t *SymbolTable) Register(s ManaSymbol) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Forget the symbol this alt text used to stand for, unless another alt
+	// text still stands for it
+	if old, found := t.byAlt[s.Alt]; found && t.bySymbol[old.Symbol].Alt == s.Alt {
+		delete(t.bySymbol, old.Symbol)
+
+		for alt, other := range t.byAlt {
+			if alt != s.Alt && other.Symbol == old.Symbol {
+				t.bySymbol[old.Symbol] = other
+				break
+			}
+		}
+	}
+
+	t.byAlt[s.Alt] = s
+	t.bySymbol[s.Symbol] = s
+}
+
+// Read a JSON array of symbols and register each one
+func (t *SymbolTable) Load(r io.Reader) error {
+	blob, err := ioutil.ReadAll(r)
+
+	if err != nil {
+		return err
+	}
+
+	var symbols []ManaSymbol
+
+	err = json.Unmarshal(blob, &symbols)
+
+	if err != nil {
+		return err
+	}
+
+	for _, s := range symbols {
+		t.Register(s)
+	}
+
+	return nil
+}
+
+// Find the symbol for a piece of Gatherer alt text. Unknown alt text is
+// logged the first time it's seen and counted.
+func (t *SymbolTable) Lookup(alt string) (ManaSymbol, bool) {
+	t.mu.RLock()
+	s, found := t.byAlt[alt]
+	t.mu.RUnlock()
+
+	if found {
+		return s, true
+	}
+
+	t.mu.Lock()
+	t.unknown[alt] += 1
+	first := t.unknown[alt] == 1
+	t.mu.Unlock()
+
+	if first {
+		log.Printf("WARNING: Unknown mana symbol %s", strconv.Quote(alt))
+	}
+
+	return ManaSymbol{}, false
+}
+
+// Find a symbol by its canonical form, e.g. {W/U}
+func (t *SymbolTable) Symbol(symbol string) (ManaSymbol, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	s, found := t.bySymbol[symbol]
+	return s, found
+}
+
+// Split a mana cost such as {2}{W/U}{W/U} into its symbols. Unrecognized
+// symbols are returned in the error.
+func (t *SymbolTable) Parse(cost string) ([]ManaSymbol, error) {
+	parsed := []ManaSymbol{}
+	unknown := []string{}
+
+	for cost != "" {
+		end := strings.Index(cost, "}")
+
+		if !strings.HasPrefix(cost, "{") || end == -1 {
+			return parsed, fmt.Errorf("malformed mana cost %s", strconv.Quote(cost))
+		}
+
+		if s, found := t.Symbol(cost[:end+1]); found {
+			parsed = append(parsed, s)
+		} else {
+			unknown = append(unknown, cost[:end+1])
+		}
+
+		cost = cost[end+1:]
+	}
+
+	if len(unknown) > 0 {
+		return parsed, fmt.Errorf("unknown mana symbols %s", strings.Join(unknown, ""))
+	}
+
+	return parsed, nil
+}
+
+// Compute the converted mana cost of a mana cost string
+func (t *SymbolTable) ConvertedCost(cost string) (float64, error) {
+	parsed, err := t.Parse(cost)
+
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0.0
+
+	for _, s := range parsed {
+		total += s.CMC
+	}
+
+	return total, nil
+}
+
+// Return how many times each unknown piece of alt text was seen
+func (t *SymbolTable) Unknown() map[string]int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	unknown := map[string]int{}
+
+	for alt, count := range t.unknown {
+		unknown[alt] = count
+	}
+
+	return unknown
+}
+
+// Log a summary of every unknown symbol seen during a crawl
+func (t *SymbolTable) Report() {
+	unknown := t.Unknown()
+	alts := []string{}
+
+	for alt := range unknown {
+		alts = append(alts, alt)
+	}
+
+	sort.Strings(alts)
+
+	for _, alt := range alts {
+		log.Printf("WARNING: Unknown mana symbol %s seen %d times", strconv.Quote(alt), unknown[alt])
+	}
+}
+
+var defaultSymbols = []ManaSymbol{
+	{Alt: "0", Symbol: "{0}", CMC: 0},
+	{Alt: "1", Symbol: "{1}", CMC: 1},
+	{Alt: "2", Symbol: "{2}", CMC: 2},
+	{Alt: "3", Symbol: "{3}", CMC: 3},
+	{Alt: "4", Symbol: "{4}", CMC: 4},
+	{Alt: "5", Symbol: "{5}", CMC: 5},
+	{Alt: "6", Symbol: "{6}", CMC: 6},
+	{Alt: "7", Symbol: "{7}", CMC: 7},
+	{Alt: "8", Symbol: "{8}", CMC: 8},
+	{Alt: "9", Symbol: "{9}", CMC: 9},
+	{Alt: "10", Symbol: "{10}", CMC: 10},
+	{Alt: "11", Symbol: "{11}", CMC: 11},
+	{Alt: "12", Symbol: "{12}", CMC: 12},
+	{Alt: "13", Symbol: "{13}", CMC: 13},
+	{Alt: "14", Symbol: "{14}", CMC: 14},
+	{Alt: "15", Symbol: "{15}", CMC: 15},
+	{Alt: "16", Symbol: "{16}", CMC: 16},
+	{Alt: "Variable Colorless", Symbol: "{X}", CMC: 0},
+	{Alt: "Snow", Symbol: "{S}", CMC: 1},
+
+	{Alt: "White", Symbol: "{W}", Colors: []string{"white"}, CMC: 1},
+	{Alt: "Blue", Symbol: "{U}", Colors: []string{"blue"}, CMC: 1},
+	{Alt: "Black", Symbol: "{B}", Colors: []string{"black"}, CMC: 1},
+	{Alt: "Red", Symbol: "{R}", Colors: []string{"red"}, CMC: 1},
+	{Alt: "Green", Symbol: "{G}", Colors: []string{"green"}, CMC: 1},
+
+	{Alt: "Half a White", Symbol: "{HW}", Colors: []string{"white"}, CMC: 0.5},
+	{Alt: "Half a Blue", Symbol: "{HU}", Colors: []string{"blue"}, CMC: 0.5},
+	{Alt: "Half a Black", Symbol: "{HB}", Colors: []string{"black"}, CMC: 0.5},
+	{Alt: "Half a Red", Symbol: "{HR}", Colors: []string{"red"}, CMC: 0.5},
+	{Alt: "Half a Green", Symbol: "{HG}", Colors: []string{"green"}, CMC: 0.5},
+	{Alt: "Half a Colorless", Symbol: "{½}", CMC: 0.5},
+
+	{Alt: "Phyrexian", Symbol: "{P}", CMC: 1, Phyrexian: true},
+	{Alt: "Phyrexian White", Symbol: "{W/P}", Colors: []string{"white"}, CMC: 1, Phyrexian: true},
+	{Alt: "Phyrexian Blue", Symbol: "{U/P}", Colors: []string{"blue"}, CMC: 1, Phyrexian: true},
+	{Alt: "Phyrexian Black", Symbol: "{B/P}", Colors: []string{"black"}, CMC: 1, Phyrexian: true},
+	{Alt: "Phyrexian Red", Symbol: "{R/P}", Colors: []string{"red"}, CMC: 1, Phyrexian: true},
+	{Alt: "Phyrexian Green", Symbol: "{G/P}", Colors: []string{"green"}, CMC: 1, Phyrexian: true},
+
+	{Alt: "White or Blue", Symbol: "{W/U}", Colors: []string{"white", "blue"}, CMC: 1, Hybrid: true},
+	{Alt: "White or Black", Symbol: "{W/B}", Colors: []string{"white", "black"}, CMC: 1, Hybrid: true},
+	{Alt: "Blue or Black", Symbol: "{U/B}", Colors: []string{"blue", "black"}, CMC: 1, Hybrid: true},
+	{Alt: "Blue or Red", Symbol: "{U/R}", Colors: []string{"blue", "red"}, CMC: 1, Hybrid: true},
+	{Alt: "Black or Red", Symbol: "{B/R}", Colors: []string{"black", "red"}, CMC: 1, Hybrid: true},
+	{Alt: "Black or Green", Symbol: "{B/G}", Colors: []string{"black", "green"}, CMC: 1, Hybrid: true},
+	{Alt: "Red or Green", Symbol: "{R/G}", Colors: []string{"red", "green"}, CMC: 1, Hybrid: true},
+	{Alt: "Red or White", Symbol: "{R/W}", Colors: []string{"red", "white"}, CMC: 1, Hybrid: true},
+	{Alt: "Green or White", Symbol: "{G/W}", Colors: []string{"green", "white"}, CMC: 1, Hybrid: true},
+	{Alt: "Green or Blue", Symbol: "{G/U}", Colors: []string{"green", "blue"}, CMC: 1, Hybrid: true},
+
+	{Alt: "Two or White", Symbol: "{2/W}", Colors: []string{"white"}, CMC: 2, Hybrid: true},
+	{Alt: "Two or Blue", Symbol: "{2/U}", Colors: []string{"blue"}, CMC: 2, Hybrid: true},
+	{Alt: "Two or Black", Symbol: "{2/B}", Colors: []string{"black"}, CMC: 2, Hybrid: true},
+	{Alt: "Two or Red", Symbol: "{2/R}", Colors: []string{"red"}, CMC: 2, Hybrid: true},
+	{Alt: "Two or Green", Symbol: "{2/G}", Colors: []string{"green"}, CMC: 2, Hybrid: true},
+
+	{Alt: "Tap", Symbol: "{T}"},
+	{Alt: "Untap", Symbol: "{Q}"},
+	{Alt: "[chaos]", Symbol: "{C}"},
+}
+
+// The symbol table used while parsing Gatherer pages
+var symbols = NewSymbolTable(defaultSymbols)
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestManaSymbol(t *testing.T) {
+	tests := map[string]string{
+		"Two or Green":  "{2/G}",
+		"Two or Green ": "{2/G}",
+		"Phyrexian Red": "{R/P}",
+		"Tap":           "{T}",
+		"15":            "{15}",
+	}
+
+	for alt, expected := range tests {
+		if sym := manaSymbol(alt); sym != expected {
+			t.Errorf("%q should be %s, not %s", alt, expected, sym)
+		}
+	}
+}
+
+func TestSymbolMetadata(t *testing.T) {
+	table := NewSymbolTable(defaultSymbols)
+
+	s, found := table.Symbol("{2/W}")
+
+	if !found {
+		t.Fatal("Couldn't find {2/W}")
+	}
+
+	if s.CMC != 2 || !s.Hybrid || s.Phyrexian || len(s.Colors) != 1 || s.Colors[0] != "white" {
+		t.Errorf("Wrong metadata for {2/W}: %+v", s)
+	}
+
+	s, _ = table.Symbol("{G/P}")
+
+	if s.CMC != 1 || !s.Phyrexian || s.Hybrid {
+		t.Errorf("Wrong metadata for {G/P}: %+v", s)
+	}
+}
+
+func TestUnknownSymbols(t *testing.T) {
+	table := NewSymbolTable(defaultSymbols)
+
+	table.Lookup("Infinity")
+	table.Lookup("Infinity")
+	table.Lookup("Blue")
+
+	unknown := table.Unknown()
+
+	if len(unknown) != 1 || unknown["Infinity"] != 2 {
+		t.Errorf("Unknown symbols should be {Infinity: 2}, not %v", unknown)
+	}
+}
+
+func TestLoadSymbols(t *testing.T) {
+	table := NewSymbolTable(defaultSymbols)
+
+	err := table.Load(strings.NewReader(`[{"alt": "Infinity", "symbol": "{∞}", "cmc": 1000000}]`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, found := table.Lookup("Infinity")
+
+	if !found || s.Symbol != "{∞}" || s.CMC != 1000000 {
+		t.Errorf("Loaded symbol was wrong: %+v", s)
+	}
+
+	if len(table.Unknown()) != 0 {
+		t.Errorf("There should be no unknown symbols")
+	}
+}
+
+func TestRegisterOverride(t *testing.T) {
+	table := NewSymbolTable(nil)
+	table.Register(ManaSymbol{Alt: "Infinity", Symbol: "{INF}", CMC: 1000000})
+	table.Register(ManaSymbol{Alt: "Infinity", Symbol: "{∞}", CMC: 1000000})
+
+	if s, found := table.Lookup("Infinity"); !found || s.Symbol != "{∞}" {
+		t.Errorf("The later registration should win: %+v", s)
+	}
+
+	if _, found := table.Symbol("{∞}"); !found {
+		t.Errorf("Couldn't find the new symbol")
+	}
+
+	if s, found := table.Symbol("{INF}"); found {
+		t.Errorf("The overridden symbol should be gone: %+v", s)
+	}
+}
+
+func TestConvertedCost(t *testing.T) {
+	tests := map[string]float64{
+		"":                    0,
+		"{5}{U}":              6,
+		"{X}{R}":              1,
+		"{2/W}{2/W}{2/W}":     6,
+		"{U/P}":               1,
+		"{W/U}{W/U}":          2,
+		"{HR}":                0.5,
+		"{3}{W}{W}":           5,
+		"{10}{G}{G}{G}{G}{G}": 15,
+	}
+
+	for cost, expected := range tests {
+		cmc, err := symbols.ConvertedCost(cost)
+
+		if err != nil {
+			t.Errorf("%s: %s", cost, err)
+			continue
+		}
+
+		if cmc != expected {
+			t.Errorf("%s should have a converted cost of %v, not %v", cost, expected, cmc)
+		}
+	}
+
+	if _, err := symbols.ConvertedCost("{2}{Z}"); err == nil {
+		t.Errorf("{Z} should be an unknown symbol")
+	}
+
+	if _, err := symbols.ConvertedCost("2}"); err == nil {
+		t.Errorf("2} should be a malformed cost")
+	}
+}
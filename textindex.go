@@ -0,0 +1,624 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// An inverted index over rules text and flavor text. Every card is a
+// document with two fields; flavor text from all of its printings is
+// indexed once per distinct paragraph. Mana symbols like {T} and {G/P} are
+// tokens of their own, so "{T}: add" finds mana abilities.
+//
+// The index is keyed by card id, so it survives sorting, and Deckbox keeps
+// it up to date as Add merges cards. Saved next to the database, it's
+// brought up to date with Sync instead of being rebuilt.
+
+const (
+	rulesField = iota
+	flavorField
+	textFields
+)
+
+var textFieldNames = [textFields]string{"rules_text", "flavor_text"}
+
+// Flavor text counts for less than rules text when ranking
+var textFieldWeights = [textFields]float64{1, 0.5}
+
+const textIndexVersion = 1
+
+type Posting struct {
+	Id        string `json:"id"`
+	Field     int    `json:"field"`
+	Positions []int  `json:"positions"`
+}
+
+type TextDoc struct {
+	// The hash of the indexed text, to tell when a card has changed
+	Hash    string          `json:"hash"`
+	Lengths [textFields]int `json:"lengths"`
+	terms   []string
+}
+
+type TextIndex struct {
+	Version  int                  `json:"version"`
+	Docs     map[string]*TextDoc  `json:"docs"`
+	Postings map[string][]Posting `json:"postings"`
+	totals   [textFields]int
+	// The sorted vocabulary for prefix matching. Writes keep it up to date,
+	// so searches can share the index.
+	vocabulary []string
+}
+
+func NewTextIndex() *TextIndex {
+	return &TextIndex{
+		Version:  textIndexVersion,
+		Docs:     map[string]*TextDoc{},
+		Postings: map[string][]Posting{},
+	}
+}
+
+func BuildTextIndex(box *Deckbox) *TextIndex {
+	ix := NewTextIndex()
+
+	for _, card := range box.Cards {
+		ix.Update(card)
+	}
+
+	return ix
+}
+
+// Split text into lower case words and mana symbols
+func tokenize(text string) []string {
+	tokens := []string{}
+	runes := []rune(text)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case r == '{':
+			end := i + 1
+
+			for end < len(runes) && runes[end] != '}' && runes[end] != '{' {
+				end += 1
+			}
+
+			if end < len(runes) && runes[end] == '}' {
+				tokens = append(tokens, strings.ToLower(string(runes[i:end+1])))
+				i = end + 1
+			} else {
+				i += 1
+			}
+		case isWordRune(r):
+			end := i
+
+			for end < len(runes) && (isWordRune(runes[end]) || isApostrophe(runes[end])) {
+				end += 1
+			}
+
+			word := strings.TrimRight(string(runes[i:end]), "'’")
+			tokens = append(tokens, normalizeName(word))
+			i = end
+		default:
+			i += 1
+		}
+	}
+
+	return tokens
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isApostrophe(r rune) bool {
+	return r == '\'' || r == '’'
+}
+
+// The paragraphs indexed for each field of a card
+func textParagraphs(card Card) [textFields][]string {
+	var paragraphs [textFields][]string
+	paragraphs[rulesField] = card.RulesText
+
+	seen := map[string]bool{}
+
+	for _, e := range card.Editions {
+		for _, p := range e.FlavorText {
+			if !seen[p] {
+				seen[p] = true
+				paragraphs[flavorField] = append(paragraphs[flavorField], p)
+			}
+		}
+	}
+
+	return paragraphs
+}
+
+func textHash(paragraphs [textFields][]string) string {
+	parts := []string{}
+
+	for _, field := range paragraphs {
+		parts = append(parts, strings.Join(field, "\n"))
+	}
+
+	return hash(strings.Join(parts, "\x00"))
+}
+
+// Add or replace a card's document
+func (ix *TextIndex) Update(card Card) {
+	paragraphs := textParagraphs(card)
+	h := textHash(paragraphs)
+
+	if doc, found := ix.Docs[card.Id]; found {
+		if doc.Hash == h {
+			return
+		}
+		ix.Remove(card.Id)
+	}
+
+	doc := &TextDoc{Hash: h}
+	positions := map[string][textFields][]int{}
+
+	for field, texts := range paragraphs {
+		pos := 0
+
+		for _, text := range texts {
+			for _, token := range tokenize(text) {
+				p := positions[token]
+				p[field] = append(p[field], pos)
+				positions[token] = p
+				pos += 1
+			}
+
+			doc.Lengths[field] = pos
+
+			// Leave a gap so phrases don't match across paragraphs
+			pos += 1
+		}
+
+		ix.totals[field] += doc.Lengths[field]
+	}
+
+	for token, fields := range positions {
+		if _, found := ix.Postings[token]; !found {
+			ix.addToken(token)
+		}
+
+		for field, p := range fields {
+			if len(p) > 0 {
+				ix.Postings[token] = append(ix.Postings[token], Posting{Id: card.Id, Field: field, Positions: p})
+			}
+		}
+
+		doc.terms = append(doc.terms, token)
+	}
+
+	sort.Strings(doc.terms)
+	ix.Docs[card.Id] = doc
+}
+
+func (ix *TextIndex) Remove(id string) {
+	doc, found := ix.Docs[id]
+
+	if !found {
+		return
+	}
+
+	for _, token := range doc.terms {
+		kept := []Posting{}
+
+		for _, p := range ix.Postings[token] {
+			if p.Id != id {
+				kept = append(kept, p)
+			}
+		}
+
+		if len(kept) == 0 {
+			delete(ix.Postings, token)
+			ix.removeToken(token)
+		} else {
+			ix.Postings[token] = kept
+		}
+	}
+
+	for field := range ix.totals {
+		ix.totals[field] -= doc.Lengths[field]
+	}
+
+	delete(ix.Docs, id)
+}
+
+func (ix *TextIndex) addToken(token string) {
+	i := sort.SearchStrings(ix.vocabulary, token)
+	ix.vocabulary = append(ix.vocabulary, "")
+	copy(ix.vocabulary[i+1:], ix.vocabulary[i:])
+	ix.vocabulary[i] = token
+}
+
+func (ix *TextIndex) removeToken(token string) {
+	i := sort.SearchStrings(ix.vocabulary, token)
+
+	if i < len(ix.vocabulary) && ix.vocabulary[i] == token {
+		ix.vocabulary = append(ix.vocabulary[:i], ix.vocabulary[i+1:]...)
+	}
+}
+
+// Bring the index up to date with the deckbox, re-indexing only the cards
+// whose text changed. Returns whether anything changed.
+func (ix *TextIndex) Sync(box *Deckbox) bool {
+	changed := false
+	ids := map[string]bool{}
+
+	for _, card := range box.Cards {
+		ids[card.Id] = true
+		doc, found := ix.Docs[card.Id]
+
+		if !found || doc.Hash != textHash(textParagraphs(card)) {
+			ix.Update(card)
+			changed = true
+		}
+	}
+
+	for id := range ix.Docs {
+		if !ids[id] {
+			ix.Remove(id)
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// Where the index for a database is saved, e.g. cards.index.json
+func textIndexPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".index.json"
+}
+
+func (ix *TextIndex) Save(path string) error {
+	for _, postings := range ix.Postings {
+		sort.Slice(postings, func(i, j int) bool {
+			if postings[i].Id != postings[j].Id {
+				return postings[i].Id < postings[j].Id
+			}
+			return postings[i].Field < postings[j].Field
+		})
+	}
+
+	blob, err := json.Marshal(ix)
+
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, blob, FlushOptions{}, nil)
+}
+
+func LoadTextIndex(path string) (*TextIndex, error) {
+	blob, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ix := NewTextIndex()
+	err = json.Unmarshal(blob, ix)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ix.Version != textIndexVersion {
+		return nil, fmt.Errorf("%s is version %d of the index, not %d", path, ix.Version, textIndexVersion)
+	}
+
+	// Rebuild what isn't saved
+	for token, postings := range ix.Postings {
+		ix.vocabulary = append(ix.vocabulary, token)
+
+		for _, p := range postings {
+			doc, found := ix.Docs[p.Id]
+
+			if !found {
+				return nil, fmt.Errorf("%s has postings for unknown card %s", path, p.Id)
+			}
+
+			if n := len(doc.terms); n == 0 || doc.terms[n-1] != token {
+				doc.terms = append(doc.terms, token)
+			}
+		}
+	}
+
+	sort.Strings(ix.vocabulary)
+
+	for _, doc := range ix.Docs {
+		sort.Strings(doc.terms)
+
+		for field := range ix.totals {
+			ix.totals[field] += doc.Lengths[field]
+		}
+	}
+
+	return ix, nil
+}
+
+// A ranked result
+type TextMatch struct {
+	Id    string  `json:"id"`
+	Score float64 `json:"score"`
+	// The fields the query matched in
+	Fields []string `json:"fields"`
+}
+
+type textTerm struct {
+	token  string
+	prefix bool
+}
+
+// Parse a text query. Every word, quoted "phrase" or word* prefix must match.
+func parseTextQuery(query string) ([][]textTerm, error) {
+	clauses := [][]textTerm{}
+	runes := []rune(query)
+
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i += 1
+			continue
+		}
+
+		var text string
+
+		if runes[i] == '"' {
+			end := i + 1
+
+			for end < len(runes) && runes[end] != '"' {
+				end += 1
+			}
+
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated quote at position %d", i)
+			}
+
+			text = string(runes[i+1 : end])
+			i = end + 1
+		} else {
+			end := i
+
+			for end < len(runes) && !unicode.IsSpace(runes[end]) {
+				end += 1
+			}
+
+			text = string(runes[i:end])
+			i = end
+		}
+
+		clause := []textTerm{}
+
+		for _, word := range strings.Fields(text) {
+			prefix := strings.HasSuffix(word, "*") && len(word) > 1
+
+			for _, token := range tokenize(strings.TrimSuffix(word, "*")) {
+				clause = append(clause, textTerm{token: token})
+			}
+
+			if prefix && len(clause) > 0 {
+				clause[len(clause)-1].prefix = true
+			}
+		}
+
+		if len(clause) > 0 {
+			clauses = append(clauses, clause)
+		}
+	}
+
+	if len(clauses) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+
+	return clauses, nil
+}
+
+type docField struct {
+	id    string
+	field int
+}
+
+// Where each term starts, by document and field
+type textHits map[docField][]int
+
+func (ix *TextIndex) termHits(term textTerm) textHits {
+	hits := textHits{}
+	tokens := []string{term.token}
+
+	if term.prefix {
+		tokens = ix.expand(term.token)
+	}
+
+	for _, token := range tokens {
+		for _, p := range ix.Postings[token] {
+			key := docField{p.Id, p.Field}
+			hits[key] = append(hits[key], p.Positions...)
+		}
+	}
+
+	for key := range hits {
+		sort.Ints(hits[key])
+	}
+
+	return hits
+}
+
+// Every token starting with prefix
+func (ix *TextIndex) expand(prefix string) []string {
+	tokens := []string{}
+
+	for i := sort.SearchStrings(ix.vocabulary, prefix); i < len(ix.vocabulary); i++ {
+		if !strings.HasPrefix(ix.vocabulary[i], prefix) {
+			break
+		}
+		tokens = append(tokens, ix.vocabulary[i])
+	}
+
+	return tokens
+}
+
+// Where the phrase starts, by document and field
+func (ix *TextIndex) phraseHits(clause []textTerm) textHits {
+	hits := ix.termHits(clause[0])
+
+	for offset, term := range clause[1:] {
+		next := ix.termHits(term)
+
+		for key, starts := range hits {
+			following := map[int]bool{}
+
+			for _, p := range next[key] {
+				following[p] = true
+			}
+
+			kept := []int{}
+
+			for _, start := range starts {
+				if following[start+offset+1] {
+					kept = append(kept, start)
+				}
+			}
+
+			if len(kept) == 0 {
+				delete(hits, key)
+			} else {
+				hits[key] = kept
+			}
+		}
+	}
+
+	return hits
+}
+
+// Find the cards matching every clause of the query, best first. Scores use
+// BM25 over each field, weighted by field.
+func (ix *TextIndex) Search(query string) ([]TextMatch, error) {
+	clauses, err := parseTextQuery(query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	const k1, b = 1.2, 0.75
+	n := float64(len(ix.Docs))
+	scores := map[string]float64{}
+	fields := map[string]*[textFields]bool{}
+	var candidates map[string]bool
+
+	for i, clause := range clauses {
+		hits := ix.phraseHits(clause)
+		matched := map[string]bool{}
+
+		for key := range hits {
+			matched[key.id] = true
+		}
+
+		if i == 0 {
+			candidates = matched
+		} else {
+			for id := range candidates {
+				if !matched[id] {
+					delete(candidates, id)
+				}
+			}
+		}
+
+		df := float64(len(matched))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+		for key, starts := range hits {
+			tf := float64(len(starts))
+			length := float64(ix.Docs[key.id].Lengths[key.field])
+			average := 1.0
+
+			if n > 0 && ix.totals[key.field] > 0 {
+				average = float64(ix.totals[key.field]) / n
+			}
+
+			score := idf * tf * (k1 + 1) / (tf + k1*(1-b+b*length/average))
+			scores[key.id] += textFieldWeights[key.field] * score
+
+			if fields[key.id] == nil {
+				fields[key.id] = &[textFields]bool{}
+			}
+
+			fields[key.id][key.field] = true
+		}
+	}
+
+	matches := []TextMatch{}
+
+	for id := range candidates {
+		match := TextMatch{Id: id, Score: scores[id], Fields: []string{}}
+
+		for field, found := range fields[id] {
+			if found {
+				match.Fields = append(match.Fields, textFieldNames[field])
+			}
+		}
+
+		matches = append(matches, match)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Id < matches[j].Id
+	})
+
+	return matches, nil
+}
+
+// The deckbox's text index, built the first time it's needed and kept up to
+// date by Add from then on
+func (d *Deckbox) TextIndex() *TextIndex {
+	if d.text == nil || len(d.text.Docs) != d.idCount() {
+		d.text = BuildTextIndex(d)
+	}
+	return d.text
+}
+
+// Use a saved index, updating it to match the cards
+func (d *Deckbox) UseTextIndex(ix *TextIndex) bool {
+	changed := ix.Sync(d)
+	d.text = ix
+	return changed
+}
+
+// Load the index saved next to a database, updating it and saving it again
+// if the cards have changed since
+func openTextIndex(box *Deckbox, dbPath string) *TextIndex {
+	path := textIndexPath(dbPath)
+	ix, err := LoadTextIndex(path)
+
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("WARNING: Rebuilding text index: %s", err)
+		}
+		ix = NewTextIndex()
+	}
+
+	if box.UseTextIndex(ix) {
+		err := ix.Save(path)
+
+		if err != nil {
+			log.Printf("WARNING: Couldn't save text index: %s", err)
+		}
+	}
+
+	return ix
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tokens := tokenize("{T}: Add {G/P} to your mana pool. Urza’s Æther-touched 2/2 {broken")
+	expected := []string{"{t}", "add", "{g/p}", "to", "your", "mana", "pool", "urza's", "aether", "touched", "2", "2", "broken"}
+
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Errorf("Expected %q, got %q", expected, tokens)
+	}
+}
+
+func textCards() []Card {
+	return []Card{
+		Card{Id: "elves", Name: "Llanowar Elves", RulesText: []string{"{T}: Add {G} to your mana pool."},
+			Editions: []Edition{Edition{MultiverseId: 1, FlavorText: []string{"One bone broken for every twig snapped underfoot."}}}},
+		Card{Id: "hierarch", Name: "Noble Hierarch", RulesText: []string{"Exalted", "{T}: Add {G}, {W}, or {U} to your mana pool."},
+			Editions: []Edition{Edition{MultiverseId: 2}}},
+		Card{Id: "divination", Name: "Divination", RulesText: []string{"Draw two cards."},
+			Editions: []Edition{
+				Edition{MultiverseId: 3, FlavorText: []string{"The key to unlocking this puzzle is within you."}},
+				Edition{MultiverseId: 4, FlavorText: []string{"The key to unlocking this puzzle is within you."}},
+			}},
+		Card{Id: "opt", Name: "Opt", RulesText: []string{"Look at the top card of your library. You may put that card on the bottom of your library.", "Draw a card."},
+			Editions: []Edition{Edition{MultiverseId: 5}}},
+	}
+}
+
+func textSearch(t *testing.T, ix *TextIndex, query string) []string {
+	matches, err := ix.Search(query)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []string{}
+
+	for _, m := range matches {
+		ids = append(ids, m.Id)
+	}
+
+	return ids
+}
+
+func TestTextIndexSearch(t *testing.T) {
+	box := Deckbox{Cards: textCards()}
+	ix := BuildTextIndex(&box)
+
+	tests := map[string][]string{
+		"{T}":                  {"elves", "hierarch"},
+		`"{T}: add {G} to"`:    {"elves"},
+		"draw":                 {"divination", "opt"},
+		`"draw a card"`:        {"opt"},
+		"unlock*":              {"divination"},
+		"library draw":         {"opt"},
+		"broken":               {"elves"},
+		`"exalted {t}"`:        {},
+		"bottom library draw*": {"opt"},
+		"noble":                {},
+		`"your mana pool" {U}`: {"hierarch"},
+		"puzzle":               {"divination"},
+		"mana* {g}":            {"elves", "hierarch"},
+	}
+
+	for query, expected := range tests {
+		ids := textSearch(t, ix, query)
+
+		if len(ids) != len(expected) {
+			t.Errorf("%s found %v, not %v", query, ids, expected)
+			continue
+		}
+
+		found := map[string]bool{}
+
+		for _, id := range ids {
+			found[id] = true
+		}
+
+		for _, id := range expected {
+			if !found[id] {
+				t.Errorf("%s found %v, not %v", query, ids, expected)
+				break
+			}
+		}
+	}
+
+	matches, _ := ix.Search("draw")
+
+	if len(matches) != 2 || matches[0].Id != "divination" {
+		t.Errorf("Draw is more of Divination's short text and should rank first: %+v", matches)
+	}
+
+	if matches, _ := ix.Search("puzzle"); !reflect.DeepEqual(matches[0].Fields, []string{"flavor_text"}) {
+		t.Errorf("Puzzle only appears in flavor text: %+v", matches[0].Fields)
+	}
+
+	if _, err := ix.Search(`"unterminated`); err == nil {
+		t.Errorf("An unterminated quote should be an error")
+	}
+}
+
+func TestTextIndexFollowsAdd(t *testing.T) {
+	box := Deckbox{Cards: textCards()}
+	ix := box.TextIndex()
+
+	err := box.Add(Card{Id: "ponder", Name: "Ponder", RulesText: []string{"Draw a card."}, Editions: []Edition{Edition{MultiverseId: 6}}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = box.Add(Card{Id: "elves", Name: "Llanowar Elves", Editions: []Edition{
+		Edition{MultiverseId: 7, FlavorText: []string{"Whenever the Llanowar elves gather, the forest sings."}}}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := textSearch(t, ix, `"draw a card"`); len(ids) != 2 {
+		t.Errorf("Added cards should be searchable: %v", ids)
+	}
+
+	if ids := textSearch(t, ix, "forest sings"); len(ids) != 1 || ids[0] != "elves" {
+		t.Errorf("Merged printings should be searchable: %v", ids)
+	}
+
+	if ids := textSearch(t, ix, "twig"); len(ids) != 1 {
+		t.Errorf("Old printings should still be searchable: %v", ids)
+	}
+
+	if box.TextIndex() != ix {
+		t.Errorf("An up to date index shouldn't be rebuilt")
+	}
+}
+
+func TestTextIndexPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frantic")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	db := filepath.Join(dir, "cards.json")
+	box := Deckbox{Cards: textCards()}
+	saved := openTextIndex(&box, db)
+
+	if _, err := os.Stat(filepath.Join(dir, "cards.index.json")); err != nil {
+		t.Fatalf("The index should be saved next to the database: %s", err)
+	}
+
+	loaded, err := LoadTextIndex(textIndexPath(db))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, query := range []string{"{T}", `"draw a card"`, "unlock*"} {
+		a, b := textSearch(t, saved, query), textSearch(t, loaded, query)
+
+		if !reflect.DeepEqual(a, b) {
+			t.Errorf("%s found %v before saving and %v after", query, a, b)
+		}
+	}
+
+	if loaded.Sync(&box) {
+		t.Errorf("Nothing changed, so syncing shouldn't either")
+	}
+
+	box.Cards[3].RulesText = []string{"Scry 1.", "Draw a card."}
+	box.Cards = box.Cards[1:]
+
+	if !loaded.Sync(&box) {
+		t.Errorf("Syncing should pick up changed and removed cards")
+	}
+
+	if ids := textSearch(t, loaded, "scry"); len(ids) != 1 || ids[0] != "opt" {
+		t.Errorf("Changed card should be re-indexed: %v", ids)
+	}
+
+	if ids := textSearch(t, loaded, "twig"); len(ids) != 0 {
+		t.Errorf("Removed card should be gone: %v", ids)
+	}
+
+	if ids := textSearch(t, loaded, "library"); len(ids) != 0 {
+		t.Errorf("Old text should be gone: %v", ids)
+	}
+
+	if ids := textSearch(t, loaded, "scr*"); len(ids) != 1 || ids[0] != "opt" {
+		t.Errorf("New words should match prefixes: %v", ids)
+	}
+
+	if ids := textSearch(t, loaded, "twi*"); len(ids) != 0 {
+		t.Errorf("Removed words shouldn't match prefixes: %v", ids)
+	}
+}
+
+func TestTextIndexConcurrentSearch(t *testing.T) {
+	ix := BuildTextIndex(&Deckbox{Cards: textCards()})
+	done := make(chan []string)
+
+	for i := 0; i < 4; i++ {
+		go func() {
+			matches, _ := ix.Search("unlock*")
+			ids := []string{}
+
+			for _, m := range matches {
+				ids = append(ids, m.Id)
+			}
+
+			done <- ids
+		}()
+	}
+
+	first := <-done
+
+	for i := 1; i < 4; i++ {
+		if ids := <-done; !reflect.DeepEqual(ids, first) {
+			t.Errorf("Concurrent searches disagree: %v and %v", first, ids)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// A Violation is one way a database isn't internally consistent
+type Violation struct {
+	Rule    string `json:"rule"`
+	Id      string `json:"id,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message"`
+}
+
+type validationRule struct {
+	name  string
+	check func(box *Deckbox) []Violation
+}
+
+var validationRules = []validationRule{
+	{"partner-card", checkPartners},
+	{"edition-fields", checkEditions},
+	{"unique-multiverse-id", checkMultiverseIds},
+	{"converted-cost", checkConvertedCosts},
+	{"power-toughness", checkPowerToughness},
+	{"id-scheme", checkIds},
+	{"unique-id", checkUniqueIds},
+}
+
+// Run every rule against the database
+func Validate(box *Deckbox) []Violation {
+	violations := []Violation{}
+
+	for _, rule := range validationRules {
+		for _, v := range rule.check(box) {
+			v.Rule = rule.name
+			violations = append(violations, v)
+		}
+	}
+
+	return violations
+}
+
+func violation(card Card, format string, args ...interface{}) Violation {
+	return Violation{Id: card.Id, Name: card.Name, Message: fmt.Sprintf(format, args...)}
+}
+
+// Every partner card exists and points back
+func checkPartners(box *Deckbox) []Violation {
+	violations := []Violation{}
+
+	for _, card := range box.Cards {
+		if card.PartnerCard == "" {
+			continue
+		}
+
+		partner, found := box.ById(card.PartnerCard)
+
+		if !found {
+			violations = append(violations, violation(card, "partner card %s doesn't exist", card.PartnerCard))
+		} else if partner.PartnerCard != card.Id {
+			violations = append(violations, violation(card, "partner card %s (%s) doesn't point back", partner.Name, partner.Id))
+		}
+	}
+
+	return violations
+}
+
+// Every edition has a multiverse id and a set
+func checkEditions(box *Deckbox) []Violation {
+	violations := []Violation{}
+
+	for _, card := range box.Cards {
+		if len(card.Editions) == 0 {
+			violations = append(violations, violation(card, "card has no editions"))
+		}
+
+		for _, e := range card.Editions {
+			if e.MultiverseId == 0 {
+				violations = append(violations, violation(card, "edition in %q has no multiverse id", e.Set))
+			}
+
+			if e.Set == "" {
+				violations = append(violations, violation(card, "edition %d has no set", e.MultiverseId))
+			}
+		}
+	}
+
+	return violations
+}
+
+// A multiverse id belongs to one card, or to both halves of one split card
+func checkMultiverseIds(box *Deckbox) []Violation {
+	violations := []Violation{}
+	owners := map[int][]Card{}
+	ids := []int{}
+
+	for _, card := range box.Cards {
+		for _, e := range card.Editions {
+			if len(owners[e.MultiverseId]) == 0 {
+				ids = append(ids, e.MultiverseId)
+			}
+			owners[e.MultiverseId] = append(owners[e.MultiverseId], card)
+		}
+	}
+
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		cards := owners[id]
+
+		if len(cards) == 1 {
+			continue
+		}
+
+		if len(cards) == 2 && cards[0].PartnerCard == cards[1].Id && cards[1].PartnerCard == cards[0].Id {
+			continue
+		}
+
+		for _, card := range cards {
+			violations = append(violations, violation(card, "multiverse id %d belongs to %d cards", id, len(cards)))
+		}
+	}
+
+	return violations
+}
+
+// The converted cost matches the mana cost. The back face of a double-faced
+// or flip card uses its front face's converted cost instead.
+func checkConvertedCosts(box *Deckbox) []Violation {
+	violations := []Violation{}
+
+	for _, card := range box.Cards {
+		expected, err := symbols.ConvertedCost(card.ManaCost)
+
+		if err != nil {
+			violations = append(violations, violation(card, "%s", err))
+			continue
+		}
+
+		if card.ManaCost == "" && card.Special != "" && card.Special != "split" {
+			if partner, found := box.ById(card.PartnerCard); found {
+				expected = partner.ConvertedCost
+			}
+		}
+
+		if card.ConvertedCost != expected {
+			violations = append(violations, violation(card, "converted cost is %v but %s costs %v",
+				card.ConvertedCost, card.ManaCost, expected))
+		}
+	}
+
+	return violations
+}
+
+// Only creatures, and vehicles that become them, have power and toughness
+func checkPowerToughness(box *Deckbox) []Violation {
+	violations := []Violation{}
+
+	for _, card := range box.Cards {
+		if card.Power == "" && card.Toughness == "" {
+			continue
+		}
+
+		if !contains(card.Types, "creature") && !contains(card.Subtypes, "vehicle") {
+			violations = append(violations, violation(card, "%s has power and toughness %s/%s",
+				card.TypeLine(), card.Power, card.Toughness))
+		}
+	}
+
+	return violations
+}
+
+// Ids follow the scheme in ids.go
+func checkIds(box *Deckbox) []Violation {
+	violations := []Violation{}
+
+	for _, card := range box.Cards {
+		if card.Id == OracleId(card.Name) || card.Id == faceId(card.Name, 1) {
+			continue
+		}
+
+		violations = append(violations, violation(card, "id should be %s", OracleId(card.Name)))
+	}
+
+	return violations
+}
+
+// No two cards share an id
+func checkUniqueIds(box *Deckbox) []Violation {
+	violations := []Violation{}
+	counts := map[string]int{}
+
+	for _, card := range box.Cards {
+		counts[card.Id] += 1
+	}
+
+	for _, card := range box.Cards {
+		if counts[card.Id] > 1 {
+			violations = append(violations, violation(card, "id belongs to %d cards", counts[card.Id]))
+		}
+	}
+
+	return violations
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func writeViolations(w io.Writer, violations []Violation) {
+	for _, v := range violations {
+		if v.Id != "" {
+			fmt.Fprintf(w, "%s: %s (%s): %s\n", v.Rule, v.Name, v.Id, v.Message)
+		} else {
+			fmt.Fprintf(w, "%s: %s\n", v.Rule, v.Message)
+		}
+	}
+
+	fmt.Fprintf(w, "%d violations\n", len(violations))
+}
+
+// Load a database as it's stored, so the rules see the file that ships
+// rather than the copy an upgrade would produce
+func openStoredDeckbox(path string) (Deckbox, error) {
+	if isSQLite(path) {
+		store, err := OpenSQLiteStore(path)
+
+		if err != nil {
+			return Deckbox{}, err
+		}
+
+		defer store.Close()
+
+		return store.read()
+	}
+
+	file, err := os.Open(path)
+
+	if err != nil {
+		return Deckbox{}, err
+	}
+
+	defer file.Close()
+
+	return decodeDeckbox(file)
+}
+
+// frantic validate [-json] [-schema cards.schema.json] cards.json
+func validateCommand(args []string) error {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "Print violations as JSON")
+	schemaPath := flags.String("schema", "", "Check JSON files against this schema instead of the current one")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: validate [-json] [-schema cards.schema.json] cards.json")
+	}
+
+	path := flags.Arg(0)
+	violations := []Violation{}
+
+	// SQLite databases are checked by their table definitions
+	if !isSQLite(path) {
+		schema := GenerateSchema()
+
+		if *schemaPath != "" {
+			var err error
+			schema, err = loadSchema(*schemaPath)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		found, err := schema.ValidateFile(path)
+
+		if err != nil {
+			return err
+		}
+
+		violations = append(violations, found...)
+	}
+
+	box, err := openStoredDeckbox(path)
+
+	if err != nil {
+		return err
+	}
+
+	violations = append(violations, Validate(&box)...)
+
+	if *asJSON {
+		blob, err := json.MarshalIndent(violations, "", "  ")
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(blob))
+	} else {
+		writeViolations(os.Stdout, violations)
+	}
+
+	if len(violations) > 0 {
+		return fmt.Errorf("%s has %d violations", path, len(violations))
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func validCards(t *testing.T) []Card {
+	cards := []Card{}
+
+	for _, id := range []int{262875, 262699, 20574, 205740, 212241} {
+		card, err := loadCard(id)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Drop the editions that haven't been fetched yet
+		editions := []Edition{}
+
+		for _, e := range card.Editions {
+			if e.Set != "" {
+				editions = append(editions, e)
+			}
+		}
+
+		card.Editions = editions
+		cards = append(cards, card)
+	}
+
+	return cards
+}
+
+func rules(violations []Violation) map[string]int {
+	counts := map[string]int{}
+
+	for _, v := range violations {
+		counts[v.Rule] += 1
+	}
+
+	return counts
+}
+
+func TestValidateFixtures(t *testing.T) {
+	box := Deckbox{Cards: validCards(t)}
+
+	if violations := Validate(&box); len(violations) != 0 {
+		t.Errorf("Fixtures should be valid, got %+v", violations)
+	}
+}
+
+func TestValidateViolations(t *testing.T) {
+	cards := validCards(t)
+
+	// Huntmaster points at a card that doesn't exist
+	cards[0].PartnerCard = "missing"
+	// Elspeth's edition is missing its set and shares Stand's multiverse id
+	cards[4].Editions[0].Set = ""
+	cards[4].Editions[0].MultiverseId = 20574
+	// Errata without a new converted cost
+	cards[4].ManaCost = "{4}{W}{W}"
+	// A planeswalker with power and toughness
+	cards[4].Power = "4"
+	cards[4].Toughness = "4"
+	// An id from the old scheme
+	cards[2].Id = legacyId(cards[2])
+
+	box := Deckbox{Cards: cards}
+	counts := rules(Validate(&box))
+
+	expected := map[string]int{
+		// Huntmaster, Ravager, and Stand and Deliver after Deliver's id changed
+		"partner-card":         4,
+		"edition-fields":       1,
+		"unique-multiverse-id": 3,
+		"converted-cost":       1,
+		"power-toughness":      1,
+		"id-scheme":            1,
+	}
+
+	for rule, count := range expected {
+		if counts[rule] != count {
+			t.Errorf("Expected %d %s violations, got %d", count, rule, counts[rule])
+		}
+	}
+}
+
+func TestValidateUniqueIds(t *testing.T) {
+	cards := validCards(t)
+	box := Deckbox{Cards: append(cards, cards[4])}
+	counts := rules(Validate(&box))
+
+	if counts["unique-id"] != 2 {
+		t.Errorf("Expected both copies of Elspeth to be reported, got %d", counts["unique-id"])
+	}
+}
+
+// Validate checks the file as stored, not the copy loading upgrades it to
+func TestValidateStoredFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frantic")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	cards := validCards(t)
+	cards[4].Id = legacyId(cards[4])
+
+	// A version 0 file is a bare array
+	blob, err := json.Marshal(cards)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "cards.json")
+
+	if err := ioutil.WriteFile(path, blob, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	box, err := openStoredDeckbox(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if box.Header.SchemaVersion != 0 {
+		t.Errorf("Expected the stored version 0, got %d", box.Header.SchemaVersion)
+	}
+
+	if counts := rules(Validate(&box)); counts["id-scheme"] != 1 {
+		t.Errorf("Expected Elspeth's legacy id to be reported, got %d", counts["id-scheme"])
+	}
+}